@@ -0,0 +1,140 @@
+package jsonjoy
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Conformance test vectors in testdata/ follow the format of the
+// json-patch-tests suite used by json-joy: each case has a comment, a doc, a
+// patch or a pointer, and either an expected result or an error message.
+// Local vectors are transcribed from RFC 6901, RFC 6902 and json-joy
+// operation semantics so they run offline, their "code" field names the
+// expected error category. Upstream vectors have no "code", only the presence
+// of an error is checked for them. The upstream suite is fetched by
+// "make testdata" into testdata/json-patch-tests, see SOURCE there for its
+// origin and version.
+
+const upstreamTestsDir = "testdata/json-patch-tests"
+
+type conformanceCase struct {
+	Comment  string          `json:"comment"`
+	Doc      JSON            `json:"doc"`
+	Patch    JSON            `json:"patch"`
+	Pointer  string          `json:"pointer"`
+	Expected json.RawMessage `json:"expected"`
+	Error    string          `json:"error"`
+	Code     string          `json:"code"`
+	Disabled bool            `json:"disabled"`
+}
+
+// conformanceSkips lists cases which are known to fail, by file and comment,
+// with the reason. Cases disabled by the suite itself are skipped as well.
+var conformanceSkips = map[string]string{}
+
+// conformanceErrors maps error categories used in "code" to errors.
+var conformanceErrors = map[string]error{
+	"PATCH_INVALID":    ErrPatchInvalid,
+	"OP_INVALID":       ErrOperationInvalid,
+	"OP_UNKNOWN":       ErrOperationUnknown,
+	"OP_PATH_INVALID":  ErrOperationInvalidPath,
+	"OP_FROM_INVALID":  ErrOperationInvalidFrom,
+	"OP_VALUE_MISSING": ErrOperationMissingValue,
+	"pointer_invalid":  ErrPointerInvalid,
+	"NOT_FOUND":        ErrNotFound,
+	"INVALID_INDEX":    ErrInvalidIndex,
+	"NOT_A_STRING":     ErrNotAString,
+	"STR_MISMATCH":     ErrStringMismatch,
+	"TEST":             ErrTest,
+	"PREDICATE":        ErrPredicate,
+}
+
+func readConformanceCases(t *testing.T, file string) []conformanceCase {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []conformanceCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatal(err)
+	}
+	return cases
+}
+
+// runConformance runs each case in a subtest, run returns the result of the
+// case.
+func runConformance(t *testing.T, file string, run func(c conformanceCase) (JSON, error)) {
+	for _, c := range readConformanceCases(t, file) {
+		c := c
+		t.Run(c.Comment, func(t *testing.T) {
+			if c.Disabled {
+				t.Skip("disabled by the suite")
+			}
+			if reason, ok := conformanceSkips[file+": "+c.Comment]; ok {
+				t.Skip(reason)
+			}
+			res, err := run(c)
+			if c.Error == "" {
+				// Cases without expected value only check that the patch applies.
+				if assert.Nil(t, err) && c.Expected != nil {
+					var expected JSON
+					assert.Nil(t, json.Unmarshal(c.Expected, &expected))
+					assert.Equal(t, expected, res)
+				}
+				return
+			}
+			if !assert.NotNil(t, err, c.Error) || c.Code == "" {
+				return
+			}
+			category, ok := conformanceErrors[c.Code]
+			if !assert.True(t, ok, "unknown error category %s", c.Code) {
+				return
+			}
+			assert.True(t, errors.Is(err, category), "expected %s, got %v", c.Code, err)
+		})
+	}
+}
+
+func applyConformancePatch(c conformanceCase) (JSON, error) {
+	doc := c.Doc
+	ops, _, err := CreateOps(c.Patch)
+	if err == nil {
+		err = ApplyOps(&doc, ops)
+	}
+	return doc, err
+}
+
+func Test_JsonPatchConformance_RFC6902(t *testing.T) {
+	runConformance(t, "testdata/json_patch_tests.json", applyConformancePatch)
+}
+
+func Test_JsonPatchConformance_Extended(t *testing.T) {
+	runConformance(t, "testdata/json_patch_extended_tests.json", applyConformancePatch)
+}
+
+func Test_JsonPatchConformance_Upstream(t *testing.T) {
+	for _, file := range []string{"tests.json", "spec_tests.json"} {
+		path := upstreamTestsDir + "/" + file
+		t.Run(file, func(t *testing.T) {
+			if _, err := os.Stat(path); err != nil {
+				t.Skipf("%s is missing, run \"make testdata\" to fetch it", path)
+			}
+			runConformance(t, path, applyConformancePatch)
+		})
+	}
+}
+
+func Test_JsonPointerConformance_Get(t *testing.T) {
+	runConformance(t, "testdata/json_pointer_tests.json", func(c conformanceCase) (JSON, error) {
+		pointer, err := NewJSONPointer(c.Pointer)
+		if err != nil {
+			return nil, err
+		}
+		return pointer.Get(c.Doc)
+	})
+}
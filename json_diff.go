@@ -0,0 +1,432 @@
+package jsonjoy
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// DiffOptions configure how Diff compares documents.
+type DiffOptions struct {
+	// MinTextLength is the minimum length, in PositionUnit, of strings which
+	// are diffed using "str_ins" and "str_del" operations. Shorter strings are
+	// replaced.
+	MinTextLength int
+	// MaxTextChange is the maximum ratio of inserted and deleted text to
+	// length of the longer string, both measured in PositionUnit, above which
+	// the string is replaced. Zero means no limit.
+	MaxTextChange float64
+	// PositionUnit is the unit of positions and lengths of string operations.
+	PositionUnit PositionUnit
+}
+
+// DefaultDiffOptions returns options used by Diff.
+func DefaultDiffOptions() DiffOptions {
+	return DiffOptions{MinTextLength: 16, MaxTextChange: 0.5}
+}
+
+// Diff returns a list of JSON Patch operations which transform src into dst.
+// Objects are compared key by key, arrays are compared using the longest
+// common subsequence of their elements and long strings are compared as
+// text. Values in the patch are copied from dst, so the patch does not share
+// memory with it.
+func Diff(src JSON, dst JSON) []Op {
+	return DiffWithOptions(src, dst, DefaultDiffOptions())
+}
+
+// DiffWithOptions is like Diff, but uses provided options.
+func DiffWithOptions(src JSON, dst JSON, opts DiffOptions) []Op {
+	ops := []Op{}
+	diffValue(&ops, &opts, JSONPointer{}, src, dst)
+	return ops
+}
+
+// appendToken returns a new JSON Pointer with token appended to tokens.
+func appendToken(tokens JSONPointer, token string) JSONPointer {
+	res := make(JSONPointer, len(tokens), len(tokens)+1)
+	copy(res, tokens)
+	return append(res, token)
+}
+
+func diffValue(ops *[]Op, opts *DiffOptions, path JSONPointer, src JSON, dst JSON) {
+	if DeepEqual(src, dst) {
+		return
+	}
+	switch a := src.(type) {
+	case map[string]JSON:
+		if b, ok := dst.(map[string]JSON); ok {
+			diffObject(ops, opts, path, a, b)
+			return
+		}
+	case []JSON:
+		if b, ok := dst.([]JSON); ok {
+			diffArray(ops, opts, path, a, b)
+			return
+		}
+	case string:
+		if b, ok := dst.(string); ok && diffString(ops, opts, path, a, b) {
+			return
+		}
+	}
+	*ops = append(*ops, &OpReplace{path: path, value: Copy(dst)})
+}
+
+func diffObject(ops *[]Op, opts *DiffOptions, path JSONPointer, src map[string]JSON, dst map[string]JSON) {
+	keys := make([]string, 0, len(src))
+	for key := range src {
+		if _, ok := dst[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		*ops = append(*ops, &OpRemove{path: appendToken(path, key)})
+	}
+	keys = make([]string, 0, len(dst))
+	for key := range dst {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, ok := src[key]
+		if !ok {
+			*ops = append(*ops, &OpAdd{path: appendToken(path, key), value: Copy(dst[key])})
+			continue
+		}
+		diffValue(ops, opts, appendToken(path, key), value, dst[key])
+	}
+}
+
+// seqEditKind is a kind of a run of elements in an edit script.
+type seqEditKind int
+
+const (
+	seqKeep seqEditKind = iota
+	seqDelete
+	seqInsert
+)
+
+// seqEdit is a run of count elements which are kept, deleted or inserted.
+type seqEdit struct {
+	kind  seqEditKind
+	count int
+}
+
+// myersDiff computes the shortest edit script between sequences of element
+// ids using the linear space variant of Myers' O(ND) algorithm.
+type myersDiff struct {
+	a        []int
+	b        []int
+	edits    []seqEdit
+	deleted  int
+	inserted int
+	exceeded bool
+}
+
+// diffSequences returns the shortest edit script which transforms a into b.
+// Deletions precede insertions between kept runs. If limit is not negative
+// and the script is known to need more than limit edits, the search stops
+// and false is returned.
+func diffSequences(a []int, b []int, limit int) ([]seqEdit, bool) {
+	d := &myersDiff{a: a, b: b}
+	if !d.compare(0, len(a), 0, len(b), limit) {
+		return nil, false
+	}
+	d.flush()
+	return d.edits, true
+}
+
+func (d *myersDiff) push(kind seqEditKind, count int) {
+	if count == 0 {
+		return
+	}
+	switch kind {
+	case seqDelete:
+		d.deleted += count
+	case seqInsert:
+		d.inserted += count
+	default:
+		d.flush()
+		if last := len(d.edits) - 1; last >= 0 && d.edits[last].kind == seqKeep {
+			d.edits[last].count += count
+			return
+		}
+		d.edits = append(d.edits, seqEdit{kind: seqKeep, count: count})
+	}
+}
+
+// flush appends pending deletions and insertions.
+func (d *myersDiff) flush() {
+	if d.deleted > 0 {
+		d.edits = append(d.edits, seqEdit{kind: seqDelete, count: d.deleted})
+	}
+	if d.inserted > 0 {
+		d.edits = append(d.edits, seqEdit{kind: seqInsert, count: d.inserted})
+	}
+	d.deleted, d.inserted = 0, 0
+}
+
+// compare appends edits which transform a[aLo:aHi] into b[bLo:bHi].
+func (d *myersDiff) compare(aLo int, aHi int, bLo int, bHi int, limit int) bool {
+	prefix := 0
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+		prefix++
+	}
+	suffix := 0
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+		suffix++
+	}
+	d.push(seqKeep, prefix)
+	switch {
+	case aLo == aHi:
+		d.push(seqInsert, bHi-bLo)
+	case bLo == bHi:
+		d.push(seqDelete, aHi-aLo)
+	default:
+		x, y, ok := d.bisect(aLo, aHi, bLo, bHi, limit)
+		if d.exceeded {
+			return false
+		}
+		if !ok || (x == aLo && y == bLo) || (x == aHi && y == bHi) {
+			d.push(seqDelete, aHi-aLo)
+			d.push(seqInsert, bHi-bLo)
+		} else {
+			d.compare(aLo, x, bLo, y, -1)
+			d.compare(x, aHi, y, bHi, -1)
+		}
+	}
+	d.push(seqKeep, suffix)
+	return true
+}
+
+// bisect finds the middle snake of the edit graph of a[aLo:aHi] and
+// b[bLo:bHi], searching forward from the start and backward from the end, and
+// returns the point where the problem is split in two. Returns false if the
+// sequences have nothing in common.
+func (d *myersDiff) bisect(aLo int, aHi int, bLo int, bHi int, limit int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	size := 2*maxD + 2
+	v1 := make([]int, size)
+	v2 := make([]int, size)
+	for index := range v1 {
+		v1[index], v2[index] = -1, -1
+	}
+	v1[offset+1], v2[offset+1] = 0, 0
+	delta := n - m
+	// If delta is odd, paths overlap while searching forward, otherwise
+	// while searching backward.
+	front := delta%2 != 0
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+	for step := 0; step < maxD; step++ {
+		// Paths of step-1 edits did not overlap, so at least 2*step-1 edits
+		// are needed.
+		if limit >= 0 && 2*step-1 > limit {
+			d.exceeded = true
+			return 0, 0, false
+		}
+		for k1 := -step + k1start; k1 <= step-k1end; k1 += 2 {
+			k1Offset := offset + k1
+			var x1 int
+			if k1 == -step || (k1 != step && v1[k1Offset-1] < v1[k1Offset+1]) {
+				x1 = v1[k1Offset+1]
+			} else {
+				x1 = v1[k1Offset-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < m && d.a[aLo+x1] == d.b[bLo+y1] {
+				x1++
+				y1++
+			}
+			v1[k1Offset] = x1
+			switch {
+			case x1 > n:
+				k1end += 2
+			case y1 > m:
+				k1start += 2
+			case front:
+				k2Offset := offset + delta - k1
+				if k2Offset >= 0 && k2Offset < size && v2[k2Offset] != -1 && x1 >= n-v2[k2Offset] {
+					return aLo + x1, bLo + y1, true
+				}
+			}
+		}
+		for k2 := -step + k2start; k2 <= step-k2end; k2 += 2 {
+			k2Offset := offset + k2
+			var x2 int
+			if k2 == -step || (k2 != step && v2[k2Offset-1] < v2[k2Offset+1]) {
+				x2 = v2[k2Offset+1]
+			} else {
+				x2 = v2[k2Offset-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < m && d.a[aHi-x2-1] == d.b[bHi-y2-1] {
+				x2++
+				y2++
+			}
+			v2[k2Offset] = x2
+			switch {
+			case x2 > n:
+				k2end += 2
+			case y2 > m:
+				k2start += 2
+			case !front:
+				k1Offset := offset + delta - k2
+				if k1Offset >= 0 && k1Offset < size && v1[k1Offset] != -1 {
+					x1 := v1[k1Offset]
+					y1 := offset + x1 - k1Offset
+					if x1 >= n-x2 {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// hashJSON returns a hash of value, values which are DeepEqual have equal
+// hashes.
+func hashJSON(value JSON) uint64 {
+	h := fnv.New64a()
+	var buf [9]byte
+	switch v := value.(type) {
+	case nil:
+		buf[0] = 1
+	case bool:
+		buf[0] = 2
+		if v {
+			buf[0] = 3
+		}
+	case float64:
+		if v == 0 {
+			// Negative zero is equal to zero.
+			v = 0
+		}
+		buf[0] = 4
+		binary.BigEndian.PutUint64(buf[1:], math.Float64bits(v))
+	case string:
+		buf[0] = 5
+		h.Write(buf[:1])
+		h.Write([]byte(v))
+		return h.Sum64()
+	case []JSON:
+		buf[0] = 6
+		h.Write(buf[:1])
+		for _, item := range v {
+			binary.BigEndian.PutUint64(buf[1:], hashJSON(item))
+			h.Write(buf[1:])
+		}
+		return h.Sum64()
+	case map[string]JSON:
+		// Sum of hashes of entries does not depend on order of keys.
+		var sum uint64
+		for key, item := range v {
+			sum += hashJSON([]JSON{key, item})
+		}
+		buf[0] = 7
+		binary.BigEndian.PutUint64(buf[1:], sum)
+	}
+	h.Write(buf[:])
+	return h.Sum64()
+}
+
+// elementIDs maps elements of src and dst to ids, elements have equal ids
+// only if they are DeepEqual.
+func elementIDs(src []JSON, dst []JSON) ([]int, []int) {
+	type entry struct {
+		value JSON
+		id    int
+	}
+	buckets := map[uint64][]entry{}
+	next := 0
+	id := func(value JSON) int {
+		hash := hashJSON(value)
+		for _, e := range buckets[hash] {
+			if DeepEqual(e.value, value) {
+				return e.id
+			}
+		}
+		buckets[hash] = append(buckets[hash], entry{value: value, id: next})
+		next++
+		return next - 1
+	}
+	a := make([]int, len(src))
+	for index, value := range src {
+		a[index] = id(value)
+	}
+	b := make([]int, len(dst))
+	for index, value := range dst {
+		b[index] = id(value)
+	}
+	return a, b
+}
+
+// diffArray emits operations for elements which are not part of the shortest
+// edit script. A removed element followed by an inserted one is diffed in
+// place instead of being removed and added.
+func diffArray(ops *[]Op, opts *DiffOptions, path JSONPointer, src []JSON, dst []JSON) {
+	prefix := 0
+	for prefix < len(src) && prefix < len(dst) && DeepEqual(src[prefix], dst[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(src)-prefix && suffix < len(dst)-prefix && DeepEqual(src[len(src)-1-suffix], dst[len(dst)-1-suffix]) {
+		suffix++
+	}
+	a, b := elementIDs(src[prefix:len(src)-suffix], dst[prefix:len(dst)-suffix])
+	edits, _ := diffSequences(a, b, -1)
+	pos, i, j := prefix, prefix, prefix
+	for index := 0; index < len(edits); index++ {
+		edit := edits[index]
+		removed, inserted := 0, 0
+		switch edit.kind {
+		case seqKeep:
+			pos += edit.count
+			i += edit.count
+			j += edit.count
+			continue
+		case seqDelete:
+			removed = edit.count
+			if index+1 < len(edits) && edits[index+1].kind == seqInsert {
+				index++
+				inserted = edits[index].count
+			}
+		case seqInsert:
+			inserted = edit.count
+		}
+		for ; removed > 0 && inserted > 0; removed, inserted = removed-1, inserted-1 {
+			diffValue(ops, opts, appendToken(path, strconv.Itoa(pos)), src[i], dst[j])
+			i++
+			j++
+			pos++
+		}
+		for ; removed > 0; removed-- {
+			*ops = append(*ops, &OpRemove{path: appendToken(path, strconv.Itoa(pos))})
+			i++
+		}
+		for ; inserted > 0; inserted-- {
+			*ops = append(*ops, &OpAdd{path: appendToken(path, strconv.Itoa(pos)), value: Copy(dst[j])})
+			j++
+			pos++
+		}
+	}
+}
+
+// diffString emits text operations which transform src into dst, returns
+// false if the strings should be replaced instead.
+func diffString(ops *[]Op, opts *DiffOptions, path JSONPointer, src string, dst string) bool {
+	text, ok := diffText(path, src, dst, opts)
+	if !ok {
+		return false
+	}
+	*ops = append(*ops, text...)
+	return true
+}
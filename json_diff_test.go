@@ -0,0 +1,112 @@
+package jsonjoy
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var diffCases = [][2]string{
+	{`1`, `1`},
+	{`1`, `2`},
+	{`"a"`, `null`},
+	{`{}`, `[]`},
+	{`{"a": 1}`, `{"a": 1, "b": 2}`},
+	{`{"a": 1, "b": 2}`, `{"b": 2}`},
+	{`{"a": {"b": {"c": 1}}}`, `{"a": {"b": {"c": 2, "d": [1]}}}`},
+	{`[]`, `[1, 2, 3]`},
+	{`[1, 2, 3]`, `[]`},
+	{`[1, 2, 3]`, `[1, 3]`},
+	{`[1, 3]`, `[1, 2, 3]`},
+	{`[1, 2, 3, 4, 5]`, `[5, 4, 3, 2, 1]`},
+	{`[1, 2, 3]`, `[0, 1, 2, 3, 4]`},
+	{`["a", "b", "c", "d"]`, `["x", "b", "y", "z", "d", "e"]`},
+	{`[{"id": 1}, {"id": 2}, {"id": 3}]`, `[{"id": 1}, {"id": 2, "x": true}, {"id": 3}]`},
+	{`[[1, 2], [3]]`, `[[1], [3, 4], [5]]`},
+	{`{"list": [1, {"a": [true]}], "s": "x"}`, `{"list": [{"a": [false]}, 1], "s": "y", "n": null}`},
+}
+
+func Test_JsonDiff_Diff_TransformsSourceIntoDestination(t *testing.T) {
+	for _, pair := range diffCases {
+		src := parseJSON(pair[0])
+		dst := parseJSON(pair[1])
+		ops := Diff(src, dst)
+		doc := Copy(src)
+		assert.Nil(t, ApplyOps(&doc, ops), pair[0]+" -> "+pair[1])
+		assert.True(t, DeepEqual(dst, doc), pair[0]+" -> "+pair[1])
+		assert.True(t, DeepEqual(parseJSON(pair[0]), src), "source is not modified")
+	}
+}
+
+func Test_JsonDiff_Diff_EmptyForEqualDocuments(t *testing.T) {
+	ops := Diff(parseJSON(`{"a": [1, {"b": null}]}`), parseJSON(`{"a": [1, {"b": null}]}`))
+	assert.Equal(t, 0, len(ops))
+}
+
+func Test_JsonDiff_Diff_ObjectKeys(t *testing.T) {
+	ops := Diff(parseJSON(`{"a": 1, "b": 2, "c": 3}`), parseJSON(`{"c": 4, "a": 1, "d": 5}`))
+	assert.Equal(t, parseJSON(`[
+		{"op": "remove", "path": "/b"},
+		{"op": "replace", "path": "/c", "value": 4},
+		{"op": "add", "path": "/d", "value": 5}
+	]`), JSON(PatchToJSON(ops)))
+}
+
+func Test_JsonDiff_Diff_ArrayKeepsCommonElements(t *testing.T) {
+	ops := Diff(parseJSON(`[1, 2, 3, 4]`), parseJSON(`[1, 3, 4, 5]`))
+	assert.Equal(t, parseJSON(`[
+		{"op": "remove", "path": "/1"},
+		{"op": "add", "path": "/3", "value": 5}
+	]`), JSON(PatchToJSON(ops)))
+}
+
+func Test_JsonDiff_Diff_ArrayReplacesChangedElements(t *testing.T) {
+	ops := Diff(parseJSON(`[1, {"a": 1}, 3]`), parseJSON(`[1, {"a": 2}, 3]`))
+	assert.Equal(t, parseJSON(`[
+		{"op": "replace", "path": "/1/a", "value": 2}
+	]`), JSON(PatchToJSON(ops)))
+}
+
+func Test_JsonDiff_Diff_EscapesKeys(t *testing.T) {
+	ops := Diff(parseJSON(`{}`), parseJSON(`{"a/b": {"~": 1}}`))
+	assert.Equal(t, parseJSON(`[
+		{"op": "add", "path": "/a~1b", "value": {"~": 1}}
+	]`), JSON(PatchToJSON(ops)))
+}
+
+func Test_JsonDiff_Diff_DoesNotShareMemoryWithDestination(t *testing.T) {
+	dst := parseJSON(`{"a": {"b": 1}}`)
+	ops := Diff(parseJSON(`{}`), dst)
+	dst.(map[string]JSON)["a"].(map[string]JSON)["b"] = 2.0
+	assert.Equal(t, parseJSON(`{"b": 1}`), ops[0].(*OpAdd).Value())
+}
+
+func Test_JsonDiff_Diff_LargeArraysDoNotAllocateQuadraticMemory(t *testing.T) {
+	src := make([]JSON, 4000)
+	dst := make([]JSON, 4000)
+	for index := range src {
+		src[index] = float64(index)
+		dst[index] = float64(index)
+		if index%3 == 0 {
+			dst[index] = -float64(index) - 1
+		}
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	ops := Diff(JSON(src), JSON(dst))
+	runtime.ReadMemStats(&after)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(32<<20))
+	assert.Equal(t, 1334, len(ops))
+	doc := Copy(JSON(src))
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, JSON(dst), doc)
+}
+
+func Test_JsonDiff_Diff_ArrayElementsAreComparedDeeply(t *testing.T) {
+	ops := Diff(parseJSON(`[{"a": 1, "b": [2]}, -0, {"c": null}]`), parseJSON(`[{"c": null}, {"b": [2], "a": 1}, 0]`))
+	assert.Equal(t, parseJSON(`[
+		{"op": "add", "path": "/0", "value": {"c": null}},
+		{"op": "remove", "path": "/3"}
+	]`), JSON(PatchToJSON(ops)))
+}
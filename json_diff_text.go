@@ -0,0 +1,100 @@
+package jsonjoy
+
+// DiffText returns "str_ins" and "str_del" operations which transform string
+// src located at path into dst. Positions are measured in UTF-16 code units.
+func DiffText(path JSONPointer, src string, dst string) []Op {
+	return DiffTextWithOptions(path, src, dst, DiffOptions{})
+}
+
+// DiffTextWithOptions is like DiffText, but uses provided options. Lengths are
+// measured and positions are emitted in opts.PositionUnit. If the strings are
+// shorter than opts.MinTextLength or change more than opts.MaxTextChange
+// allows, a single "replace" operation is returned instead.
+func DiffTextWithOptions(path JSONPointer, src string, dst string, opts DiffOptions) []Op {
+	if src == dst {
+		return []Op{}
+	}
+	ops, ok := diffText(path, src, dst, &opts)
+	if !ok {
+		return []Op{&OpReplace{path: path, value: dst}}
+	}
+	return ops
+}
+
+// diffText returns text operations which transform src into dst, or false if
+// the strings should be replaced instead according to opts.
+func diffText(path JSONPointer, src string, dst string, opts *DiffOptions) ([]Op, bool) {
+	srcLength, dstLength := stringLength(src, opts.PositionUnit), stringLength(dst, opts.PositionUnit)
+	if srcLength < opts.MinTextLength || dstLength < opts.MinTextLength {
+		return nil, false
+	}
+	longest := srcLength
+	if dstLength > longest {
+		longest = dstLength
+	}
+	limit := -1
+	if opts.MaxTextChange > 0 {
+		limit = int(opts.MaxTextChange * float64(longest))
+	}
+	// Edits are counted in characters, which are never longer than in the
+	// position unit, so the limit can stop the search early.
+	a, b := []rune(src), []rune(dst)
+	edits, ok := diffSequences(runeIDs(a), runeIDs(b), limit)
+	if !ok {
+		return nil, false
+	}
+	if limit >= 0 {
+		changed, i, j := 0, 0, 0
+		for _, edit := range edits {
+			switch edit.kind {
+			case seqKeep:
+				i += edit.count
+				j += edit.count
+			case seqDelete:
+				changed += stringLength(string(a[i:i+edit.count]), opts.PositionUnit)
+				i += edit.count
+			case seqInsert:
+				changed += stringLength(string(b[j:j+edit.count]), opts.PositionUnit)
+				j += edit.count
+			}
+		}
+		if changed > limit {
+			return nil, false
+		}
+	}
+	return textOps(path, a, b, edits, opts.PositionUnit), true
+}
+
+// runeIDs converts characters to element ids compared by diffSequences.
+func runeIDs(runes []rune) []int {
+	ids := make([]int, len(runes))
+	for index, r := range runes {
+		ids[index] = int(r)
+	}
+	return ids
+}
+
+// textOps converts an edit script which transforms src into dst to string
+// operations with positions measured in unit.
+func textOps(path JSONPointer, src []rune, dst []rune, edits []seqEdit, unit PositionUnit) []Op {
+	ops := []Op{}
+	pos, i, j := 0, 0, 0
+	for _, edit := range edits {
+		switch edit.kind {
+		case seqKeep:
+			pos += stringLength(string(src[i:i+edit.count]), unit)
+			i += edit.count
+			j += edit.count
+		case seqDelete:
+			length := stringLength(string(src[i:i+edit.count]), unit)
+			ops = append(ops, &OpStrDel{path: path, pos: pos, len: length, unit: unit})
+			i += edit.count
+		case seqInsert:
+			str := string(dst[j : j+edit.count])
+			ops = append(ops, &OpStrIns{path: path, pos: pos, str: str, unit: unit})
+			pos += stringLength(str, unit)
+			j += edit.count
+		}
+	}
+	return ops
+}
@@ -0,0 +1,129 @@
+package jsonjoy
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var textDiffCases = [][2]string{
+	{"", ""},
+	{"", "abc"},
+	{"abc", ""},
+	{"abc", "abc"},
+	{"abc", "abxc"},
+	{"kitten", "sitting"},
+	{"The quick brown fox", "The slow brown dog"},
+	{"abcabba", "cbabac"},
+	{"hello world", "world hello"},
+	{"añb€c", "a€bñc"},
+	{"😀 smile", "😃 smile!"},
+}
+
+func Test_JsonDiffText_DiffText_TransformsString(t *testing.T) {
+	for _, pair := range textDiffCases {
+		ops := DiffText(JSONPointer{"s"}, pair[0], pair[1])
+		var doc JSON = map[string]JSON{"s": pair[0]}
+		assert.Nil(t, ApplyOps(&doc, ops), pair[0]+" -> "+pair[1])
+		assert.Equal(t, pair[1], doc.(map[string]JSON)["s"], pair[0]+" -> "+pair[1])
+		for _, op := range ops {
+			assert.Contains(t, []string{"str_ins", "str_del"}, op.Code())
+		}
+	}
+}
+
+func Test_JsonDiffText_DiffText_EmitsMinimalEdits(t *testing.T) {
+	ops := DiffText(JSONPointer{}, "The cat sat", "The dog sat")
+	assert.Equal(t, parseJSON(`[
+		{"op": "str_del", "path": "", "pos": 4, "len": 3},
+		{"op": "str_ins", "path": "", "pos": 4, "str": "dog"}
+	]`), JSON(PatchToJSON(ops)))
+	assert.Equal(t, 0, len(DiffText(JSONPointer{}, "abc", "abc")))
+}
+
+func Test_JsonDiffText_DiffTextWithOptions_AppliesOptions(t *testing.T) {
+	ops := DiffTextWithOptions(JSONPointer{"s"}, "a😀b", "a😀cb", DiffOptions{PositionUnit: PositionRunes})
+	assert.Equal(t, parseJSON(`[
+		{"op": "str_ins", "path": "/s", "pos": 2, "str": "c"}
+	]`), JSON(PatchToJSON(ops)))
+	var doc JSON = map[string]JSON{"s": "a😀b"}
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, "a😀cb", doc.(map[string]JSON)["s"])
+	ops = DiffTextWithOptions(JSONPointer{"s"}, "abc", "abd", DiffOptions{MinTextLength: 4})
+	assert.Equal(t, parseJSON(`[
+		{"op": "replace", "path": "/s", "value": "abd"}
+	]`), JSON(PatchToJSON(ops)))
+	ops = DiffTextWithOptions(JSONPointer{"s"}, "abcd", "wxyz", DiffOptions{MaxTextChange: 0.5})
+	assert.Equal(t, []string{"replace"}, opCodes(ops))
+	assert.Equal(t, 0, len(DiffTextWithOptions(JSONPointer{"s"}, "a", "a", DiffOptions{MinTextLength: 4})))
+}
+
+func Test_JsonDiffText_DiffTextWithOptions_MeasuresInPositionUnit(t *testing.T) {
+	src, dst := "😀😀😀😀aaaa", "aaaa"
+	opts := DiffOptions{MaxTextChange: 0.6, PositionUnit: PositionRunes}
+	assert.Equal(t, []string{"str_del"}, opCodes(DiffTextWithOptions(JSONPointer{}, src, dst, opts)))
+	opts.PositionUnit = PositionUTF16
+	assert.Equal(t, []string{"replace"}, opCodes(DiffTextWithOptions(JSONPointer{}, src, dst, opts)))
+	src, dst = "😀😀", "😀a😀"
+	opts = DiffOptions{MinTextLength: 3, PositionUnit: PositionRunes}
+	assert.Equal(t, []string{"replace"}, opCodes(DiffTextWithOptions(JSONPointer{}, src, dst, opts)))
+	opts.PositionUnit = PositionUTF16
+	assert.Equal(t, []string{"str_ins"}, opCodes(DiffTextWithOptions(JSONPointer{}, src, dst, opts)))
+}
+
+func Test_JsonDiffText_Diff_UsesTextOperationsForLongStrings(t *testing.T) {
+	src := parseJSON(`{"title": "Lorem ipsum dolor sit amet", "tag": "a"}`)
+	dst := parseJSON(`{"title": "Lorem ipsum dolor sit amet, consectetur", "tag": "b"}`)
+	ops := Diff(src, dst)
+	assert.Equal(t, parseJSON(`[
+		{"op": "replace", "path": "/tag", "value": "b"},
+		{"op": "str_ins", "path": "/title", "pos": 26, "str": ", consectetur"}
+	]`), JSON(PatchToJSON(ops)))
+	assert.Nil(t, ApplyOps(&src, ops))
+	assert.Equal(t, dst, src)
+}
+
+func Test_JsonDiffText_DiffWithOptions_ReplacesAboveThreshold(t *testing.T) {
+	src := parseJSON(`["aaaaaaaaaaaaaaaaaaaa"]`)
+	dst := parseJSON(`["bbbbbbbbbbaaaaaaaaaa"]`)
+	ops := DiffWithOptions(src, dst, DiffOptions{MinTextLength: 1, MaxTextChange: 0.25})
+	assert.Equal(t, []string{"replace"}, opCodes(ops))
+	ops = DiffWithOptions(src, dst, DiffOptions{MinTextLength: 1, MaxTextChange: 1})
+	assert.Equal(t, []string{"str_del", "str_ins"}, opCodes(ops))
+	ops = DiffWithOptions(src, dst, DiffOptions{MinTextLength: 100})
+	assert.Equal(t, []string{"replace"}, opCodes(ops))
+	ops = DiffWithOptions(src, dst, DiffOptions{})
+	assert.Nil(t, ApplyOps(&src, ops))
+	assert.Equal(t, dst, src)
+}
+
+func Test_JsonDiffText_Diff_StopsEarlyForDissimilarStrings(t *testing.T) {
+	src := strings.Repeat("abcdefghij", 1600)
+	dst := strings.Repeat("klmnopqrst", 1600)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	ops := DiffWithOptions(src, dst, DefaultDiffOptions())
+	runtime.ReadMemStats(&after)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16<<20))
+	assert.Equal(t, []string{"replace"}, opCodes(ops))
+}
+
+func Test_JsonDiffText_Diff_LongSimilarStrings(t *testing.T) {
+	src := strings.Repeat("lorem ipsum dolor sit amet ", 600)
+	dst := strings.Replace(src, "dolor", "color", 20)
+	ops := Diff(JSON(src), JSON(dst))
+	assert.Equal(t, 40, len(ops))
+	doc := JSON(src)
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, JSON(dst), doc)
+}
+
+func opCodes(ops []Op) []string {
+	codes := make([]string, len(ops))
+	for index, op := range ops {
+		codes[index] = op.Code()
+	}
+	return codes
+}
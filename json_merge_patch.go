@@ -0,0 +1,102 @@
+package jsonjoy
+
+import (
+	"sort"
+)
+
+// MergePatch applies RFC 7386 JSON Merge Patch to the document. Objects are
+// merged recursively, null values remove keys, any other value replaces the
+// target. Values are copied from patch, so the document does not share memory
+// with it.
+func MergePatch(doc *JSON, patch JSON) error {
+	*doc = mergeValue(*doc, patch)
+	return nil
+}
+
+func mergeValue(target JSON, patch JSON) JSON {
+	props, ok := patch.(map[string]JSON)
+	if !ok {
+		return Copy(patch)
+	}
+	obj, ok := target.(map[string]JSON)
+	if !ok {
+		obj = map[string]JSON{}
+	}
+	for key, value := range props {
+		if value == nil {
+			delete(obj, key)
+			continue
+		}
+		obj[key] = mergeValue(obj[key], value)
+	}
+	return obj
+}
+
+// CreateMergePatch returns a JSON Merge Patch which transforms src into dst.
+// Arrays are replaced as a whole. Merge patch cannot set object keys to null,
+// such keys of dst are removed instead.
+func CreateMergePatch(src JSON, dst JSON) JSON {
+	a, ok := src.(map[string]JSON)
+	if !ok {
+		return Copy(dst)
+	}
+	b, ok := dst.(map[string]JSON)
+	if !ok {
+		return Copy(dst)
+	}
+	patch := map[string]JSON{}
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	for key, value := range b {
+		old, ok := a[key]
+		if !ok {
+			patch[key] = Copy(value)
+		} else if !DeepEqual(old, value) {
+			patch[key] = CreateMergePatch(old, value)
+		}
+	}
+	return patch
+}
+
+// MergePatchOps returns JSON Patch operations which have the same effect on
+// the document as JSON Merge Patch. Keys are processed in sorted order.
+func MergePatchOps(doc JSON, patch JSON) []Op {
+	ops := []Op{}
+	mergePatchOps(&ops, JSONPointer{}, doc, patch)
+	return ops
+}
+
+func mergePatchOps(ops *[]Op, path JSONPointer, target JSON, patch JSON) {
+	props, ok := patch.(map[string]JSON)
+	if !ok {
+		*ops = append(*ops, &OpReplace{path: path, value: Copy(patch)})
+		return
+	}
+	obj, ok := target.(map[string]JSON)
+	if !ok {
+		*ops = append(*ops, &OpReplace{path: path, value: mergeValue(nil, props)})
+		return
+	}
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := props[key]
+		old, exists := obj[key]
+		switch {
+		case value == nil:
+			if exists {
+				*ops = append(*ops, &OpRemove{path: appendToken(path, key)})
+			}
+		case exists:
+			mergePatchOps(ops, appendToken(path, key), old, value)
+		default:
+			*ops = append(*ops, &OpAdd{path: appendToken(path, key), value: mergeValue(nil, value)})
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package jsonjoy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mergePatchCases are examples from RFC 7386 Appendix A.
+var mergePatchCases = [][3]string{
+	{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+	{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+	{`{"a": "b"}`, `{"a": null}`, `{}`},
+	{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+	{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+	{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+	{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+	{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+	{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+	{`{"a": "b"}`, `["c"]`, `["c"]`},
+	{`{"a": "foo"}`, `null`, `null`},
+	{`{"a": "foo"}`, `"bar"`, `"bar"`},
+	{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+	{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+	{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+}
+
+func Test_JsonMergePatch_MergePatch_RFCExamples(t *testing.T) {
+	for _, c := range mergePatchCases {
+		doc := parseJSON(c[0])
+		assert.Nil(t, MergePatch(&doc, parseJSON(c[1])))
+		assert.Equal(t, parseJSON(c[2]), doc, c[0]+" + "+c[1])
+	}
+}
+
+func Test_JsonMergePatch_MergePatch_DoesNotShareMemoryWithPatch(t *testing.T) {
+	doc := parseJSON(`{}`)
+	patch := parseJSON(`{"a": {"b": [1]}}`)
+	MergePatch(&doc, patch)
+	patch.(map[string]JSON)["a"].(map[string]JSON)["b"] = 2.0
+	assert.Equal(t, parseJSON(`{"a": {"b": [1]}}`), doc)
+}
+
+func Test_JsonMergePatch_CreateMergePatch(t *testing.T) {
+	patch := CreateMergePatch(
+		parseJSON(`{"a": 1, "b": {"c": 1, "d": 2}, "e": [1], "f": true}`),
+		parseJSON(`{"a": 1, "b": {"c": 2}, "e": [1, 2], "g": {"h": 1}}`),
+	)
+	assert.Equal(t, parseJSON(`{"b": {"c": 2, "d": null}, "e": [1, 2], "f": null, "g": {"h": 1}}`), patch)
+}
+
+func Test_JsonMergePatch_CreateMergePatch_TransformsSourceIntoDestination(t *testing.T) {
+	for _, c := range mergePatchCases {
+		src := parseJSON(c[0])
+		dst := parseJSON(c[2])
+		doc := Copy(src)
+		MergePatch(&doc, CreateMergePatch(src, dst))
+		assert.Equal(t, dst, doc, c[0]+" -> "+c[2])
+	}
+}
+
+func Test_JsonMergePatch_MergePatchOps_EquivalentToMergePatch(t *testing.T) {
+	for _, c := range mergePatchCases {
+		doc := parseJSON(c[0])
+		assert.Nil(t, ApplyOps(&doc, MergePatchOps(parseJSON(c[0]), parseJSON(c[1]))), c[0]+" + "+c[1])
+		assert.Equal(t, parseJSON(c[2]), doc, c[0]+" + "+c[1])
+	}
+}
+
+func Test_JsonMergePatch_MergePatchOps(t *testing.T) {
+	ops := MergePatchOps(
+		parseJSON(`{"a": {"b": 1, "c": 2}, "d": [1], "e": 1}`),
+		parseJSON(`{"a": {"b": null, "x": null, "c": {"y": null, "z": 1}}, "d": {"f": 1}, "g": 1}`),
+	)
+	assert.Equal(t, parseJSON(`[
+		{"op": "remove", "path": "/a/b"},
+		{"op": "replace", "path": "/a/c", "value": {"z": 1}},
+		{"op": "replace", "path": "/d", "value": {"f": 1}},
+		{"op": "add", "path": "/g", "value": 1}
+	]`), JSON(PatchToJSON(ops)))
+}
@@ -0,0 +1,285 @@
+package jsonjoy
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// ErrMsgPackInvalid returned when MessagePack data is malformed or contains
+// values which cannot be represented as JSON.
+var ErrMsgPackInvalid = errors.New("MSGPACK_INVALID")
+
+// msgPackMaxDepth limits nesting of decoded arrays and objects.
+const msgPackMaxDepth = 1000
+
+// EncodeMsgPack encodes JSON value using MessagePack. Numbers which are
+// integers are encoded as MessagePack integers, object keys are sorted.
+func EncodeMsgPack(value JSON) []byte {
+	return appendMsgPack(nil, value)
+}
+
+func appendMsgPack(buf []byte, value JSON) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, 0xc0)
+	case bool:
+		if v {
+			return append(buf, 0xc3)
+		}
+		return append(buf, 0xc2)
+	case float64:
+		if v == math.Trunc(v) && v >= -(1<<63) && v < 1<<63 && !(v == 0 && math.Signbit(v)) {
+			return appendMsgPackInt(buf, int64(v))
+		}
+		buf = append(buf, 0xcb)
+		return appendUint64(buf, math.Float64bits(v))
+	case int:
+		return appendMsgPackInt(buf, int64(v))
+	case string:
+		length := len(v)
+		switch {
+		case length < 32:
+			buf = append(buf, 0xa0|byte(length))
+		case length <= math.MaxUint8:
+			buf = append(buf, 0xd9, byte(length))
+		case length <= math.MaxUint16:
+			buf = append(buf, 0xda)
+			buf = appendUint16(buf, uint16(length))
+		default:
+			buf = append(buf, 0xdb)
+			buf = appendUint32(buf, uint32(length))
+		}
+		return append(buf, v...)
+	case []JSON:
+		buf = appendMsgPackHeader(buf, len(v), 0x90, 0xdc)
+		for _, item := range v {
+			buf = appendMsgPack(buf, item)
+		}
+		return buf
+	case map[string]JSON:
+		buf = appendMsgPackHeader(buf, len(v), 0x80, 0xde)
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			buf = appendMsgPack(buf, key)
+			buf = appendMsgPack(buf, v[key])
+		}
+		return buf
+	}
+	return append(buf, 0xc0)
+}
+
+// appendMsgPackHeader appends header of an array or a map, fix is the
+// prefix of the short form and code is the code of the 16 bit form.
+func appendMsgPackHeader(buf []byte, length int, fix byte, code byte) []byte {
+	switch {
+	case length < 16:
+		return append(buf, fix|byte(length))
+	case length <= math.MaxUint16:
+		return appendUint16(append(buf, code), uint16(length))
+	}
+	return appendUint32(append(buf, code+1), uint32(length))
+}
+
+func appendMsgPackInt(buf []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n < 128:
+		return append(buf, byte(n))
+	case n < 0 && n >= -32:
+		return append(buf, byte(n))
+	case n >= 0 && n <= math.MaxUint8:
+		return append(buf, 0xcc, byte(n))
+	case n >= 0 && n <= math.MaxUint16:
+		return appendUint16(append(buf, 0xcd), uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		return appendUint32(append(buf, 0xce), uint32(n))
+	case n >= math.MinInt8 && n < 0:
+		return append(buf, 0xd0, byte(n))
+	case n >= math.MinInt16 && n < 0:
+		return appendUint16(append(buf, 0xd1), uint16(n))
+	case n >= math.MinInt32 && n < 0:
+		return appendUint32(append(buf, 0xd2), uint32(n))
+	}
+	return appendUint64(append(buf, 0xd3), uint64(n))
+}
+
+func appendUint16(buf []byte, n uint16) []byte {
+	return append(buf, byte(n>>8), byte(n))
+}
+
+func appendUint32(buf []byte, n uint32) []byte {
+	return append(buf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(buf []byte, n uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(n>>32)), uint32(n))
+}
+
+// DecodeMsgPack decodes a single MessagePack value into JSON. Numbers are
+// decoded as float64, binary and extension types are not supported.
+func DecodeMsgPack(data []byte) (JSON, error) {
+	d := msgPackDecoder{data: data}
+	value, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, ErrMsgPackInvalid
+	}
+	return value, nil
+}
+
+type msgPackDecoder struct {
+	data []byte
+	pos  int
+}
+
+// read returns next n bytes.
+func (d *msgPackDecoder) read(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, ErrMsgPackInvalid
+	}
+	res := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return res, nil
+}
+
+// readUint reads a big-endian unsigned integer of size bytes.
+func (d *msgPackDecoder) readUint(size int) (uint64, error) {
+	b, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (d *msgPackDecoder) decode(depth int) (JSON, error) {
+	if depth > msgPackMaxDepth {
+		return nil, ErrMsgPackInvalid
+	}
+	code, err := d.readUint(1)
+	if err != nil {
+		return nil, err
+	}
+	c := byte(code)
+	switch {
+	case c <= 0x7f:
+		return float64(c), nil
+	case c >= 0xe0:
+		return float64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		return d.decodeString(int(c & 0x1f))
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c&0x0f), depth)
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c&0x0f), depth)
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		n, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.readUint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.readUint(1 << (c - 0xcc))
+		return float64(n), err
+	case 0xd0:
+		n, err := d.readUint(1)
+		return float64(int8(n)), err
+	case 0xd1:
+		n, err := d.readUint(2)
+		return float64(int16(n)), err
+	case 0xd2:
+		n, err := d.readUint(4)
+		return float64(int32(n)), err
+	case 0xd3:
+		n, err := d.readUint(8)
+		return float64(int64(n)), err
+	case 0xd9, 0xda, 0xdb:
+		length, err := d.readUint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeString(int(length))
+	case 0xdc, 0xdd:
+		length, err := d.readUint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(length), depth)
+	case 0xde, 0xdf:
+		length, err := d.readUint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(length), depth)
+	}
+	return nil, ErrMsgPackInvalid
+}
+
+func (d *msgPackDecoder) decodeString(length int) (JSON, error) {
+	b, err := d.read(length)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgPackDecoder) decodeArray(length int, depth int) (JSON, error) {
+	// Each element takes at least one byte.
+	if length > len(d.data)-d.pos {
+		return nil, ErrMsgPackInvalid
+	}
+	arr := make([]JSON, length)
+	for index := range arr {
+		value, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr[index] = value
+	}
+	return arr, nil
+}
+
+func (d *msgPackDecoder) decodeMap(length int, depth int) (JSON, error) {
+	if length > (len(d.data)-d.pos)/2 {
+		return nil, ErrMsgPackInvalid
+	}
+	obj := make(map[string]JSON, length)
+	for index := 0; index < length; index++ {
+		key, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		str, ok := key.(string)
+		if !ok {
+			return nil, ErrMsgPackInvalid
+		}
+		value, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		obj[str] = value
+	}
+	return obj, nil
+}
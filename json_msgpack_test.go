@@ -0,0 +1,75 @@
+package jsonjoy
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JsonMsgPack_EncodeMsgPack(t *testing.T) {
+	cases := []struct {
+		value JSON
+		data  []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{false, []byte{0xc2}},
+		{0.0, []byte{0x00}},
+		{127.0, []byte{0x7f}},
+		{-1.0, []byte{0xff}},
+		{-32.0, []byte{0xe0}},
+		{-33.0, []byte{0xd0, 0xdf}},
+		{200.0, []byte{0xcc, 0xc8}},
+		{1000.0, []byte{0xcd, 0x03, 0xe8}},
+		{-1000.0, []byte{0xd1, 0xfc, 0x18}},
+		{70000.0, []byte{0xce, 0x00, 0x01, 0x11, 0x70}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"a", []byte{0xa1, 'a'}},
+		{[]JSON{1.0, "b"}, []byte{0x92, 0x01, 0xa1, 'b'}},
+		{map[string]JSON{"b": nil, "a": 1.0}, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0xc0}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.data, EncodeMsgPack(c.value), c.value)
+	}
+}
+
+func Test_JsonMsgPack_DecodeMsgPack_RoundTrip(t *testing.T) {
+	values := []JSON{
+		nil, true, false, 0.0, 1.0, -1.0, 255.0, -129.0, 65536.0, -70000.0,
+		1e15, -1e15, 0.1, math.Copysign(0, -1), math.MaxFloat64,
+		"", strings.Repeat("x", 40), strings.Repeat("y", 300), strings.Repeat("z", 70000),
+		parseJSON(`{"a": [1, 2.5, {"b": null}], "c": "d", "e": {}, "f": []}`),
+		make([]JSON, 20), parseJSON(`{"0":0,"1":1,"2":2,"3":3,"4":4,"5":5,"6":6,"7":7,"8":8,"9":9,"a":10,"b":11,"c":12,"d":13,"e":14,"f":15,"g":16}`),
+	}
+	for _, value := range values {
+		decoded, err := DecodeMsgPack(EncodeMsgPack(value))
+		assert.Nil(t, err)
+		assert.Equal(t, value, decoded)
+	}
+}
+
+func Test_JsonMsgPack_DecodeMsgPack_OtherEncodings(t *testing.T) {
+	value, err := DecodeMsgPack([]byte{0x92, 0xca, 0x3f, 0xc0, 0, 0, 0xcf, 0, 0, 0, 0, 0, 0, 0, 0x05})
+	assert.Nil(t, err)
+	assert.Equal(t, []JSON{1.5, 5.0}, value)
+}
+
+func Test_JsonMsgPack_DecodeMsgPack_Errors(t *testing.T) {
+	cases := [][]byte{
+		{},
+		{0xc1},
+		{0xa2, 'a'},
+		{0x92, 0x01},
+		{0xdd, 0xff, 0xff, 0xff, 0xff},
+		{0x81, 0x01, 0x01},
+		{0xc4, 0x01, 0x00},
+		{0x01, 0x02},
+	}
+	for _, data := range cases {
+		_, err := DecodeMsgPack(data)
+		assert.True(t, errors.Is(err, ErrMsgPackInvalid), data)
+	}
+}
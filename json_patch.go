@@ -8,6 +8,10 @@ import (
 // ErrTest is returned when JSON Patch "error" operations was not passed.
 var ErrTest = errors.New("TEST")
 
+// ErrStringMismatch is returned when text deleted by "str_del" operation does
+// not match its "str" field.
+var ErrStringMismatch = errors.New("STR_MISMATCH")
+
 // Inserts an element into a slice and shifts needed elements to right.
 func insert(slice []interface{}, pos int, value interface{}) []interface{} {
 	length := len(slice)
@@ -83,6 +87,8 @@ func Add(doc *JSON, tokens JSONPointer, value JSON) error {
 			return err
 		}
 		*doc = doc2
+	default:
+		return ErrNotFound
 	}
 	return nil
 }
@@ -116,6 +122,8 @@ func Replace(doc *JSON, tokens JSONPointer, value JSON) error {
 			return ErrNotFound
 		}
 		container[index] = value
+	default:
+		return ErrNotFound
 	}
 	return nil
 }
@@ -158,7 +166,7 @@ func Remove(doc *JSON, tokens JSONPointer) (JSON, error) {
 		*doc = doc2
 		return value, nil
 	}
-	return nil, nil
+	return nil, ErrNotFound
 }
 
 // Move executes JSON Patch "move" operation.
@@ -181,21 +189,37 @@ func JSONPatchCopy(doc *JSON, from JSONPointer, to JSONPointer) error {
 
 // JSONPatchTest executes JSON Patch "test" operation.
 func JSONPatchTest(doc *JSON, path JSONPointer, value JSON) error {
+	return jsonPatchTest(doc, path, value, false)
+}
+
+// JSONPatchTestNot executes JSON Patch+ "test" operation with the "not" flag
+// set, it passes when the value at path is not equal to value or is missing.
+func JSONPatchTestNot(doc *JSON, path JSONPointer, value JSON) error {
+	return jsonPatchTest(doc, path, value, true)
+}
+
+// unresolved checks if err means that there is no value at a location.
+func unresolved(err error) bool {
+	return err == ErrNotFound || err == ErrInvalidIndex
+}
+
+func jsonPatchTest(doc *JSON, path JSONPointer, value JSON, not bool) error {
 	target, err := path.Get(*doc)
+	if not && unresolved(err) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	if !DeepEqual(value, target) {
+	if DeepEqual(value, target) == not {
 		return ErrTest
 	}
 	return nil
 }
 
-func insertString(src string, pos int, ins string) string {
-	if pos > len(src) {
-		pos = len(src)
-	}
-	return src[:pos] + ins + src[pos:]
+func insertString(src string, pos int, ins string, unit PositionUnit) string {
+	offset := stringOffset(src, pos, unit)
+	return src[:offset] + ins + src[offset:]
 }
 
 func jsonPatchStrOp(doc *JSON, tokens JSONPointer, fn func(str *string) (string, error)) error {
@@ -256,12 +280,19 @@ func jsonPatchStrOp(doc *JSON, tokens JSONPointer, fn func(str *string) (string,
 			return err
 		}
 		container[index] = res
+	default:
+		return ErrNotFound
 	}
 	return nil
 }
 
-// JSONPatchStrIns insert string into an existing string.
+// JSONPatchStrIns insert string into an existing string, pos is measured in
+// UTF-16 code units.
 func JSONPatchStrIns(doc *JSON, tokens JSONPointer, pos int, ins string) error {
+	return jsonPatchStrIns(doc, tokens, pos, ins, PositionUTF16)
+}
+
+func jsonPatchStrIns(doc *JSON, tokens JSONPointer, pos int, ins string, unit PositionUnit) error {
 	return jsonPatchStrOp(doc, tokens, func(str *string) (string, error) {
 		if str == nil {
 			if pos == 0 {
@@ -269,43 +300,62 @@ func JSONPatchStrIns(doc *JSON, tokens JSONPointer, pos int, ins string) error {
 			}
 			return "", errors.New("POS")
 		}
-		return insertString(*str, pos, ins), nil
+		return insertString(*str, pos, ins, unit), nil
 	})
 }
 
-func deleteString(src string, pos int, length int) string {
-	strLength := len(src)
-	if pos >= strLength {
+func deleteString(src string, pos int, length int, unit PositionUnit) string {
+	start := stringOffset(src, pos, unit)
+	end := stringOffset(src, pos+length, unit)
+	if end <= start {
 		return src
 	}
-	start := src[:pos]
-	if pos+length >= strLength {
-		return start
-	}
-	return start + src[pos+length:]
+	return src[:start] + src[end:]
 }
 
-// JSONPatchStrDel deletes string from an existing string.
+// JSONPatchStrDel deletes string from an existing string, pos and
+// deletionLength are measured in UTF-16 code units.
 func JSONPatchStrDel(doc *JSON, tokens JSONPointer, pos int, deletionLength int) error {
+	return jsonPatchStrDel(doc, tokens, pos, deletionLength, PositionUTF16)
+}
+
+func jsonPatchStrDel(doc *JSON, tokens JSONPointer, pos int, deletionLength int, unit PositionUnit) error {
 	return jsonPatchStrOp(doc, tokens, func(str *string) (string, error) {
 		if str == nil {
 			return "", ErrNotFound
 		}
-		return deleteString(*str, pos, deletionLength), nil
+		return deleteString(*str, pos, deletionLength, unit), nil
 	})
 }
 
+// JSONPatchStrDelString deletes string del from an existing string, verifies
+// that del is located at pos, measured in UTF-16 code units.
+func JSONPatchStrDelString(doc *JSON, tokens JSONPointer, pos int, del string) error {
+	return jsonPatchStrDelString(doc, tokens, pos, del, PositionUTF16)
+}
+
+func jsonPatchStrDelString(doc *JSON, tokens JSONPointer, pos int, del string, unit PositionUnit) error {
+	return jsonPatchStrOp(doc, tokens, func(str *string) (string, error) {
+		if str == nil {
+			return "", ErrNotFound
+		}
+		length := stringLength(del, unit)
+		if substring(*str, pos, pos+length, unit) != del {
+			return "", ErrStringMismatch
+		}
+		return deleteString(*str, pos, length, unit), nil
+	})
+}
+
+// flip negates value treating it as a boolean the way JavaScript does: null,
+// zero and empty string are false, other values are true.
 func flip(value interface{}) bool {
 	if value == nil {
 		return true
 	}
 	switch val := value.(type) {
 	case string:
-		if len(val) > 0 {
-			return false
-		}
-		return false
-
+		return len(val) == 0
 	case float64:
 		if val == 0.0 {
 			return true
@@ -318,10 +368,16 @@ func flip(value interface{}) bool {
 	return false
 }
 
-// JSONPatchFlip flips a cell treating it as a boolean.
-func jsonPatchFlip(doc *JSON, tokens JSONPointer) error {
+// updateValue replaces an existing value located by tokens with the result
+// of fn. If create is set, a missing object property is set to the result of
+// fn called with nil.
+func updateValue(doc *JSON, tokens JSONPointer, create bool, fn func(value JSON) (JSON, error)) error {
 	if tokens.IsRoot() {
-		*doc = flip(*doc)
+		res, err := fn(*doc)
+		if err != nil {
+			return err
+		}
+		*doc = res
 		return nil
 	}
 	parentTokens := tokens[:len(tokens)-1]
@@ -330,14 +386,17 @@ func jsonPatchFlip(doc *JSON, tokens JSONPointer) error {
 		return err
 	}
 	key := tokens[len(tokens)-1]
-	objInterface := *obj
-	switch container := objInterface.(type) {
+	switch container := (*obj).(type) {
 	case map[string]JSON:
 		val, ok := container[key]
-		if !ok {
+		if !ok && !create {
 			return ErrNotFound
 		}
-		container[key] = flip(val)
+		res, err := fn(val)
+		if err != nil {
+			return err
+		}
+		container[key] = res
 	case []JSON:
 		index, err := ParseTokenAsArrayIndex(key, len(container)-1)
 		if err != nil {
@@ -346,103 +405,287 @@ func jsonPatchFlip(doc *JSON, tokens JSONPointer) error {
 		if index >= len(container) {
 			return ErrNotFound
 		}
-		container[index] = flip(container[index])
+		res, err := fn(container[index])
+		if err != nil {
+			return err
+		}
+		container[index] = res
+	default:
+		return ErrNotFound
 	}
 	return nil
 }
 
+// JSONPatchFlip flips a cell treating it as a boolean, a missing object
+// property is set to true.
+func jsonPatchFlip(doc *JSON, tokens JSONPointer) error {
+	return updateValue(doc, tokens, true, func(value JSON) (JSON, error) {
+		return flip(value), nil
+	})
+}
+
 // ApplyOperation applies a single operation.
-func ApplyOperation(doc *JSON, operation interface{}) error {
-	switch op := operation.(type) {
-	case *OpAdd:
-		return op.apply(doc)
-	case *OpReplace:
-		return op.apply(doc)
-	case *OpRemove:
-		return op.apply(doc)
-	case *OpMove:
-		return op.apply(doc)
-	case *OpCopy:
-		return op.apply(doc)
-	case *OpStrIns:
-		return op.apply(doc)
-	case *OpStrDel:
-		return op.apply(doc)
-	case *OpFlip:
-		return op.apply(doc)
-	case *OpInc:
-		return op.apply(doc)
+func ApplyOperation(doc *JSON, op Op) error {
+	return op.Apply(doc)
+}
+
+// ErrNotANumber is returned in strict mode when "inc" operation targets a
+// value which is not a number.
+var ErrNotANumber = errors.New("NOT_A_NUMBER")
+
+// ErrNotABoolean is returned in strict mode when "flip" operation targets a
+// value which is not a boolean.
+var ErrNotABoolean = errors.New("NOT_A_BOOLEAN")
+
+// ErrOperationNotAllowed is returned when a patch contains an operation which
+// is not in ApplyOptions.AllowedOps.
+var ErrOperationNotAllowed = errors.New("OP_NOT_ALLOWED")
+
+// ErrPatchTooLarge is returned when a patch has more operations than
+// ApplyOptions.MaxOps.
+var ErrPatchTooLarge = errors.New("PATCH_TOO_LARGE")
+
+// RFC6902Ops returns names of operations defined by RFC 6902 JSON Patch, they
+// can be used as ApplyOptions.AllowedOps to reject JSON Patch+ extensions.
+func RFC6902Ops() []string {
+	return []string{"add", "remove", "replace", "move", "copy", "test"}
+}
+
+// ApplyOptions configure how a patch is applied.
+type ApplyOptions struct {
+	// Strict disables type coercion: "inc" fails on values which are not
+	// numbers, "flip" on values which are not booleans and both of them and
+	// "str_ins" on missing values.
+	Strict bool
+	// Clone applies the patch to a deep copy of the document, which replaces
+	// the document only if all operations succeed. Values of the original
+	// document are not modified.
+	Clone bool
+	// AllowedOps lists names of operations which can be used in the patch,
+	// including predicates nested in "and", "or" and "not". "test" with the
+	// JSON Patch+ "not" flag set requires "not" to be allowed. Nil allows all
+	// operations.
+	AllowedOps []string
+	// MaxOps is the maximum number of operations in the patch, zero means no
+	// limit.
+	MaxOps int
+	// Atomic restores the document to its original state if any operation
+	// fails, see ApplyOpsAtomic. Unlike Clone, the patch is applied in place.
+	Atomic bool
+}
+
+// checkOps verifies that ops are permitted by options, before any of them is
+// applied.
+func checkOps(ops []Op, opts *ApplyOptions) error {
+	if opts.MaxOps > 0 && len(ops) > opts.MaxOps {
+		return &PatchError{Index: -1, Depth: -1, Err: ErrPatchTooLarge}
+	}
+	if opts.AllowedOps == nil {
+		return nil
+	}
+	allowed := make(map[string]bool, len(opts.AllowedOps))
+	for _, name := range opts.AllowedOps {
+		allowed[name] = true
+	}
+	for index, op := range ops {
+		if !isOpAllowed(op, allowed) {
+			return &PatchError{Index: index, Op: op.Code(), Depth: -1, Err: ErrOperationNotAllowed}
+		}
+	}
+	return nil
+}
+
+func isOpAllowed(op Op, allowed map[string]bool) bool {
+	if !allowed[op.Code()] {
+		return false
+	}
+	var children []PredicateOp
+	switch o := op.(type) {
+	case *OpAnd:
+		children = o.ops
+	case *OpOr:
+		children = o.ops
+	case *OpNot:
+		children = o.ops
 	case *OpTest:
-		err := op.apply(doc)
-		if err != nil {
-			return err
+		// Negated "test" is a JSON Patch+ extension equivalent to "not".
+		return !o.not || allowed["not"]
+	}
+	for _, child := range children {
+		if !isOpAllowed(child, allowed) {
+			return false
 		}
 	}
+	return true
+}
+
+// strictOp is implemented by operations which behave differently in strict
+// mode.
+type strictOp interface {
+	applyStrict(doc *JSON) error
+}
+
+func applyOp(doc *JSON, op Op, opts *ApplyOptions) error {
+	if strict, ok := op.(strictOp); ok && opts.Strict {
+		return strict.applyStrict(doc)
+	}
+	return op.Apply(doc)
+}
+
+// ApplyOps applies a JSON Patch to the document. Returned error is a
+// *PatchError.
+func ApplyOps(doc *JSON, ops []Op) error {
+	return ApplyOpsWithOptions(doc, ops, ApplyOptions{})
+}
+
+// ApplyOpsWithOptions is like ApplyOps, but uses provided options. Returned
+// error is a *PatchError.
+func ApplyOpsWithOptions(doc *JSON, ops []Op, opts ApplyOptions) error {
+	if err := checkOps(ops, &opts); err != nil {
+		return err
+	}
+	if opts.Atomic && !opts.Clone {
+		_, err := applyOpsAtomic(doc, ops, &opts)
+		return err
+	}
+	target := doc
+	if opts.Clone {
+		clone := Copy(*doc)
+		target = &clone
+	}
+	for index, op := range ops {
+		// "move" removes the value before adding it, so its JSON Pointers are
+		// resolved before it is applied, of other operations only on failure.
+		move, isMove := op.(*OpMove)
+		var depth opDepth
+		if isMove {
+			depth = resolveOpDepth(*target, move)
+		}
+		if err := applyOp(target, op, &opts); err != nil {
+			if !isMove {
+				depth = resolveOpDepth(*target, op)
+			}
+			return newApplyError(index, op, depth, err)
+		}
+	}
+	*doc = *target
 	return nil
 }
 
-// ApplyOps applies a JSON Patch to the document.
-func ApplyOps(doc *JSON, ops []interface{}) error {
-	for _, op := range ops {
-		var err error
-		err = ApplyOperation(doc, op)
+// ApplyOpsAtomic applies a JSON Patch to the document, if any of operations
+// fails, the document is restored to its original state. Inverse operations
+// are recorded as the patch is applied and undone on failure, the document is
+// copied only for operations which cannot be inverted. Second return argument
+// is the index of the failed operation, or -1. Returned error is a
+// *PatchError. Use ApplyOpsWithOptions with ApplyOptions.Atomic to combine it
+// with other options.
+func ApplyOpsAtomic(doc *JSON, ops []Op) (int, error) {
+	return applyOpsAtomic(doc, ops, &ApplyOptions{})
+}
+
+func applyOpsAtomic(doc *JSON, ops []Op, opts *ApplyOptions) (int, error) {
+	undo := make([][]Op, 0, len(ops))
+	for index, op := range ops {
+		inverse := inverseOp(*doc, op)
+		// "move" removes the value before adding it, and operations which
+		// cannot be inverted may change the document before failing.
+		failed := []Op(nil)
+		if move, ok := op.(*OpMove); ok {
+			failed = inverseFailedMove(*doc, move)
+		} else if isSnapshot(inverse) {
+			failed = inverse
+		}
+		err := applyOp(doc, op, opts)
 		if err != nil {
-			return err
+			// JSON Pointers are resolved once the failed operation is undone.
+			rollbackErr := rollback(doc, [][]Op{failed})
+			depth := resolveOpDepth(*doc, op)
+			if rollbackErr == nil {
+				rollbackErr = rollback(doc, undo)
+			}
+			if rollbackErr != nil {
+				return index, newApplyError(index, op, depth, rollbackErr)
+			}
+			return index, newApplyError(index, op, depth, err)
 		}
+		undo = append(undo, inverse)
 	}
-	return nil
+	return -1, nil
 }
 
-func (op *OpAdd) apply(doc *JSON) error {
+func (op *OpAdd) Apply(doc *JSON) error {
 	return Add(doc, op.path, Copy(op.value))
 }
 
-func (op *OpReplace) apply(doc *JSON) error {
+func (op *OpReplace) Apply(doc *JSON) error {
 	return Replace(doc, op.path, Copy(op.value))
 }
 
-func (op *OpRemove) apply(doc *JSON) error {
+func (op *OpRemove) Apply(doc *JSON) error {
 	_, err := Remove(doc, op.path)
 	return err
 }
 
-func (op *OpMove) apply(doc *JSON) error {
+func (op *OpMove) Apply(doc *JSON) error {
 	err := Move(doc, op.from, op.path)
 	return err
 }
 
-func (op *OpCopy) apply(doc *JSON) error {
+func (op *OpCopy) Apply(doc *JSON) error {
 	err := JSONPatchCopy(doc, op.from, op.path)
 	return err
 }
 
-func (op *OpTest) apply(doc *JSON) error {
-	err := JSONPatchTest(doc, op.path, op.value)
+func (op *OpTest) Apply(doc *JSON) error {
+	err := jsonPatchTest(doc, op.path, op.value, op.not)
 	return err
 }
 
-func (op *OpStrIns) apply(doc *JSON) error {
-	err := JSONPatchStrIns(doc, op.path, op.pos, op.str)
+func (op *OpStrIns) Apply(doc *JSON) error {
+	err := jsonPatchStrIns(doc, op.path, op.pos, op.str, op.unit)
 	return err
 }
 
-func (op *OpStrDel) apply(doc *JSON) error {
-	err := JSONPatchStrDel(doc, op.path, op.pos, op.len)
+func (op *OpStrIns) applyStrict(doc *JSON) error {
+	return jsonPatchStrOp(doc, op.path, func(str *string) (string, error) {
+		if str == nil {
+			return "", ErrNotFound
+		}
+		return insertString(*str, op.pos, op.str, op.unit), nil
+	})
+}
+
+func (op *OpStrDel) Apply(doc *JSON) error {
+	if op.str != "" {
+		return jsonPatchStrDelString(doc, op.path, op.pos, op.str, op.unit)
+	}
+	err := jsonPatchStrDel(doc, op.path, op.pos, op.len, op.unit)
 	return err
 }
 
-func (op *OpFlip) apply(doc *JSON) error {
+func (op *OpFlip) Apply(doc *JSON) error {
 	err := jsonPatchFlip(doc, op.path)
 	return err
 }
 
+func (op *OpFlip) applyStrict(doc *JSON) error {
+	return updateValue(doc, op.path, false, func(value JSON) (JSON, error) {
+		val, ok := value.(bool)
+		if !ok {
+			return nil, ErrNotABoolean
+		}
+		return !val, nil
+	})
+}
+
 func castToFloat64(val interface{}) float64 {
 	if val == nil {
 		return 0
 	}
-	switch f := val.(type) {
-	case float64:
+	if f, ok := toFloat64(val); ok {
 		return f
+	}
+	switch f := val.(type) {
 	case bool:
 		if f {
 			return 1
@@ -457,34 +700,50 @@ func castToFloat64(val interface{}) float64 {
 	return 1
 }
 
-func (op *OpInc) apply(doc *JSON) error {
-	if op.path.IsRoot() {
-		*doc = castToFloat64(*doc) + op.inc
-		return nil
-	}
-	parentTokens := op.path[:len(op.path)-1]
-	obj, err := parentTokens.Find(doc)
-	if err != nil {
-		return err
-	}
-	key := op.path[len(op.path)-1]
-	objInterface := *obj
-	switch container := objInterface.(type) {
-	case map[string]JSON:
-		val, ok := container[key]
+func (op *OpInc) Apply(doc *JSON) error {
+	return updateValue(doc, op.path, true, func(value JSON) (JSON, error) {
+		return castToFloat64(value) + op.inc, nil
+	})
+}
+
+// toFloat64 converts a value of any Go numeric type to float64, returns false
+// if value is not a number.
+func toFloat64(value JSON) (float64, bool) {
+	switch num := value.(type) {
+	case float64:
+		return num, true
+	case float32:
+		return float64(num), true
+	case int:
+		return float64(num), true
+	case int8:
+		return float64(num), true
+	case int16:
+		return float64(num), true
+	case int32:
+		return float64(num), true
+	case int64:
+		return float64(num), true
+	case uint:
+		return float64(num), true
+	case uint8:
+		return float64(num), true
+	case uint16:
+		return float64(num), true
+	case uint32:
+		return float64(num), true
+	case uint64:
+		return float64(num), true
+	}
+	return 0, false
+}
+
+func (op *OpInc) applyStrict(doc *JSON) error {
+	return updateValue(doc, op.path, false, func(value JSON) (JSON, error) {
+		num, ok := toFloat64(value)
 		if !ok {
-			return ErrNotFound
+			return nil, ErrNotANumber
 		}
-		container[key] = castToFloat64(val) + op.inc
-	case []JSON:
-		index, err := ParseTokenAsArrayIndex(key, len(container)-1)
-		if err != nil {
-			return err
-		}
-		if index >= len(container) {
-			return ErrNotFound
-		}
-		container[index] = castToFloat64(container[index]) + op.inc
-	}
-	return nil
+		return num + op.inc, nil
+	})
 }
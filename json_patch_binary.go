@@ -0,0 +1,19 @@
+package jsonjoy
+
+// EncodeBinary encodes a list of operations into binary form, which is the
+// compact form with JSON Pointers as arrays of reference tokens, encoded using
+// MessagePack.
+func EncodeBinary(ops []Op) []byte {
+	return EncodeMsgPack(EncodeCompact(ops, CompactOptions{TokenPointers: true}))
+}
+
+// DecodeBinary decodes and validates a list of operations in binary form.
+// Returned error is a *PatchError.
+func DecodeBinary(data []byte) ([]Op, error) {
+	patch, err := DecodeMsgPack(data)
+	if err != nil {
+		return nil, &PatchError{Index: -1, Depth: -1, Err: err}
+	}
+	ops, _, err := DecodeCompact(patch)
+	return ops, err
+}
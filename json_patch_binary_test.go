@@ -0,0 +1,40 @@
+package jsonjoy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JsonPatchBinary_EncodeBinary_RoundTrip(t *testing.T) {
+	ops, _, err := CreateOps(parseJSON(compactPatch))
+	assert.Nil(t, err)
+	decoded, err := DecodeBinary(EncodeBinary(ops))
+	assert.Nil(t, err)
+	assert.Equal(t, PatchToJSON(ops), PatchToJSON(decoded))
+}
+
+func Test_JsonPatchBinary_EncodeBinary(t *testing.T) {
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "str_ins", "path": "/doc/text", "pos": 12, "str": "a"}
+	]`))
+	data := EncodeBinary(ops)
+	assert.Equal(t, []byte{
+		0x91, 0x94, 0x06,
+		0x92, 0xa3, 'd', 'o', 'c', 0xa4, 't', 'e', 'x', 't',
+		0x0c, 0xa1, 'a',
+	}, data)
+	text, _ := json.Marshal(PatchToJSON(ops))
+	assert.True(t, len(data) < len(text)/3)
+}
+
+func Test_JsonPatchBinary_DecodeBinary_Errors(t *testing.T) {
+	_, err := DecodeBinary([]byte{0x91})
+	assert.True(t, errors.Is(err, ErrMsgPackInvalid))
+	assert.Equal(t, -1, err.(*PatchError).Index)
+	_, err = DecodeBinary(EncodeMsgPack(parseJSON(`[[8, ["a"]], [99, []]]`)))
+	assert.True(t, errors.Is(err, ErrOperationUnknown))
+	assert.Equal(t, 1, err.(*PatchError).Index)
+}
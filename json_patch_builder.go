@@ -0,0 +1,336 @@
+package jsonjoy
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+// PatchBuilder constructs a list of validated JSON Patch operations. Methods
+// which accept a location take either a JSON Pointer string or a JSONPointer.
+// Values are converted to JSON types through their encoding/json form, so
+// that for example integers become float64. The first validation error stops
+// the builder and is returned by Build.
+type PatchBuilder struct {
+	ops  []Op
+	err  error
+	unit PositionUnit
+}
+
+// NewPatchBuilder creates an empty PatchBuilder.
+func NewPatchBuilder() *PatchBuilder {
+	return &PatchBuilder{ops: []Op{}}
+}
+
+// PositionUnit sets the unit of positions and lengths of string operations
+// appended after it, UTF-16 code units are used by default.
+func (b *PatchBuilder) PositionUnit(unit PositionUnit) *PatchBuilder {
+	b.unit = unit
+	return b
+}
+
+// toPointer converts a JSON Pointer string, a JSONPointer or a slice of
+// tokens to a JSONPointer. Returns invalid error if the type is not supported.
+func toPointer(path interface{}, invalid error) (JSONPointer, error) {
+	switch p := path.(type) {
+	case string:
+		return NewJSONPointer(p)
+	case JSONPointer:
+		tokens := make(JSONPointer, len(p))
+		copy(tokens, p)
+		return tokens, nil
+	case []string:
+		tokens := make(JSONPointer, len(p))
+		copy(tokens, p)
+		return tokens, nil
+	}
+	return nil, invalid
+}
+
+func (b *PatchBuilder) path(path interface{}) JSONPointer {
+	if b.err != nil {
+		return nil
+	}
+	pointer, err := toPointer(path, ErrOperationInvalidPath)
+	if err != nil {
+		b.err = err
+	}
+	return pointer
+}
+
+func (b *PatchBuilder) from(from interface{}) JSONPointer {
+	if b.err != nil {
+		return nil
+	}
+	pointer, err := toPointer(from, ErrOperationInvalidFrom)
+	if err != nil {
+		b.err = err
+	}
+	return pointer
+}
+
+func (b *PatchBuilder) position(pos int) int {
+	if b.err == nil && pos < 0 {
+		b.err = ErrOperationInvalid
+	}
+	return pos
+}
+
+func (b *PatchBuilder) value(value JSON) JSON {
+	if b.err != nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		b.err = ErrOperationInvalidValue
+		return nil
+	}
+	var normalized JSON
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		b.err = ErrOperationInvalidValue
+	}
+	return normalized
+}
+
+func (b *PatchBuilder) props(props map[string]JSON) map[string]JSON {
+	if props == nil {
+		return nil
+	}
+	normalized, _ := b.value(props).(map[string]JSON)
+	return normalized
+}
+
+func (b *PatchBuilder) types(types ...string) []string {
+	if b.err == nil && len(types) == 0 {
+		b.err = ErrOperationInvalid
+	}
+	for _, typ := range types {
+		if b.err == nil && !jsonTypes[typ] {
+			b.err = ErrOperationInvalid
+		}
+	}
+	return types
+}
+
+// predicates checks that ops are predicates located at path or inside it.
+func (b *PatchBuilder) predicates(path JSONPointer, ops []Op) []PredicateOp {
+	predicates := make([]PredicateOp, len(ops))
+	for index, op := range ops {
+		predicate, ok := op.(PredicateOp)
+		if b.err == nil && !ok {
+			b.err = ErrOperationInvalid
+		}
+		if b.err == nil && !equalPointers(path, op.Path()) && !isPrefix(path, op.Path()) {
+			b.err = ErrOperationInvalidPath
+		}
+		predicates[index] = predicate
+	}
+	return predicates
+}
+
+func (b *PatchBuilder) push(op Op) *PatchBuilder {
+	if b.err == nil {
+		b.ops = append(b.ops, op)
+	}
+	return b
+}
+
+// Add appends "add" operation.
+func (b *PatchBuilder) Add(path interface{}, value JSON) *PatchBuilder {
+	return b.push(&OpAdd{path: b.path(path), value: b.value(value)})
+}
+
+// Remove appends "remove" operation.
+func (b *PatchBuilder) Remove(path interface{}) *PatchBuilder {
+	return b.push(&OpRemove{path: b.path(path)})
+}
+
+// Replace appends "replace" operation.
+func (b *PatchBuilder) Replace(path interface{}, value JSON) *PatchBuilder {
+	return b.push(&OpReplace{path: b.path(path), value: b.value(value)})
+}
+
+// Move appends "move" operation.
+func (b *PatchBuilder) Move(from interface{}, path interface{}) *PatchBuilder {
+	return b.push(&OpMove{from: b.from(from), path: b.path(path)})
+}
+
+// Copy appends "copy" operation.
+func (b *PatchBuilder) Copy(from interface{}, path interface{}) *PatchBuilder {
+	return b.push(&OpCopy{from: b.from(from), path: b.path(path)})
+}
+
+// Test appends "test" operation.
+func (b *PatchBuilder) Test(path interface{}, value JSON) *PatchBuilder {
+	return b.push(&OpTest{path: b.path(path), value: b.value(value)})
+}
+
+// TestNot appends "test" operation with "not" flag set.
+func (b *PatchBuilder) TestNot(path interface{}, value JSON) *PatchBuilder {
+	return b.push(&OpTest{path: b.path(path), value: b.value(value), not: true})
+}
+
+// StrIns appends "str_ins" operation.
+func (b *PatchBuilder) StrIns(path interface{}, pos int, str string) *PatchBuilder {
+	return b.push(&OpStrIns{path: b.path(path), pos: b.position(pos), str: str, unit: b.unit})
+}
+
+// StrDel appends "str_del" operation.
+func (b *PatchBuilder) StrDel(path interface{}, pos int, length int) *PatchBuilder {
+	return b.push(&OpStrDel{path: b.path(path), pos: b.position(pos), len: b.position(length), unit: b.unit})
+}
+
+// StrDelString appends "str_del" operation which deletes str, the operation
+// fails if str is not located at pos.
+func (b *PatchBuilder) StrDelString(path interface{}, pos int, str string) *PatchBuilder {
+	return b.push(&OpStrDel{path: b.path(path), pos: b.position(pos), len: stringLength(str, b.unit), str: str, unit: b.unit})
+}
+
+// Flip appends "flip" operation.
+func (b *PatchBuilder) Flip(path interface{}) *PatchBuilder {
+	return b.push(&OpFlip{path: b.path(path)})
+}
+
+// Inc appends "inc" operation.
+func (b *PatchBuilder) Inc(path interface{}, inc float64) *PatchBuilder {
+	return b.push(&OpInc{path: b.path(path), inc: inc})
+}
+
+// Split appends "split" operation, props can be nil.
+func (b *PatchBuilder) Split(path interface{}, pos int, props map[string]JSON) *PatchBuilder {
+	return b.push(&OpSplit{path: b.path(path), pos: b.position(pos), props: b.props(props), unit: b.unit})
+}
+
+// Merge appends "merge" operation, props can be nil.
+func (b *PatchBuilder) Merge(path interface{}, pos int, props map[string]JSON) *PatchBuilder {
+	return b.push(&OpMerge{path: b.path(path), pos: b.position(pos), props: b.props(props)})
+}
+
+// Extend appends "extend" operation.
+func (b *PatchBuilder) Extend(path interface{}, props map[string]JSON, deleteNull bool) *PatchBuilder {
+	if b.err == nil && props == nil {
+		b.err = ErrOperationInvalid
+	}
+	return b.push(&OpExtend{path: b.path(path), props: b.props(props), deleteNull: deleteNull})
+}
+
+// Defined appends "defined" operation.
+func (b *PatchBuilder) Defined(path interface{}) *PatchBuilder {
+	return b.push(&OpDefined{path: b.path(path)})
+}
+
+// Undefined appends "undefined" operation.
+func (b *PatchBuilder) Undefined(path interface{}) *PatchBuilder {
+	return b.push(&OpUndefined{path: b.path(path)})
+}
+
+// Type appends "type" operation.
+func (b *PatchBuilder) Type(path interface{}, typ string) *PatchBuilder {
+	return b.push(&OpType{path: b.path(path), value: b.types(typ)[0]})
+}
+
+// TestType appends "test_type" operation.
+func (b *PatchBuilder) TestType(path interface{}, types ...string) *PatchBuilder {
+	return b.push(&OpTestType{path: b.path(path), types: b.types(types...)})
+}
+
+// Starts appends "starts" operation.
+func (b *PatchBuilder) Starts(path interface{}, value string, ignoreCase bool) *PatchBuilder {
+	return b.push(&OpStarts{path: b.path(path), value: value, ignoreCase: ignoreCase})
+}
+
+// Ends appends "ends" operation.
+func (b *PatchBuilder) Ends(path interface{}, value string, ignoreCase bool) *PatchBuilder {
+	return b.push(&OpEnds{path: b.path(path), value: value, ignoreCase: ignoreCase})
+}
+
+// Contains appends "contains" operation.
+func (b *PatchBuilder) Contains(path interface{}, value string, ignoreCase bool) *PatchBuilder {
+	return b.push(&OpContains{path: b.path(path), value: value, ignoreCase: ignoreCase})
+}
+
+// Matches appends "matches" operation, value is a regular expression.
+func (b *PatchBuilder) Matches(path interface{}, value string, ignoreCase bool) *PatchBuilder {
+	expr := value
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if b.err == nil && err != nil {
+		b.err = ErrOperationInvalid
+	}
+	return b.push(&OpMatches{path: b.path(path), value: value, ignoreCase: ignoreCase, regexp: re})
+}
+
+// TestString appends "test_string" operation.
+func (b *PatchBuilder) TestString(path interface{}, pos int, str string) *PatchBuilder {
+	return b.push(&OpTestString{path: b.path(path), pos: b.position(pos), str: str, unit: b.unit})
+}
+
+// TestStringNot appends "test_string" operation with "not" flag set.
+func (b *PatchBuilder) TestStringNot(path interface{}, pos int, str string) *PatchBuilder {
+	return b.push(&OpTestString{path: b.path(path), pos: b.position(pos), str: str, not: true, unit: b.unit})
+}
+
+// TestStringLen appends "test_string_len" operation.
+func (b *PatchBuilder) TestStringLen(path interface{}, length int) *PatchBuilder {
+	return b.push(&OpTestStringLen{path: b.path(path), len: b.position(length), unit: b.unit})
+}
+
+// TestStringLenNot appends "test_string_len" operation with "not" flag set.
+func (b *PatchBuilder) TestStringLenNot(path interface{}, length int) *PatchBuilder {
+	return b.push(&OpTestStringLen{path: b.path(path), len: b.position(length), not: true, unit: b.unit})
+}
+
+// Less appends "less" operation.
+func (b *PatchBuilder) Less(path interface{}, value float64) *PatchBuilder {
+	return b.push(&OpLess{path: b.path(path), value: value})
+}
+
+// More appends "more" operation.
+func (b *PatchBuilder) More(path interface{}, value float64) *PatchBuilder {
+	return b.push(&OpMore{path: b.path(path), value: value})
+}
+
+// In appends "in" operation.
+func (b *PatchBuilder) In(path interface{}, values ...JSON) *PatchBuilder {
+	list, _ := b.value(append([]JSON{}, values...)).([]JSON)
+	return b.push(&OpIn{path: b.path(path), value: list})
+}
+
+// And appends "and" operation. Predicates have absolute paths located at
+// path or inside it, for example ones built by another PatchBuilder.
+func (b *PatchBuilder) And(path interface{}, predicates []Op) *PatchBuilder {
+	pointer := b.path(path)
+	return b.push(&OpAnd{path: pointer, ops: b.predicates(pointer, predicates)})
+}
+
+// Or appends "or" operation, see And for predicates.
+func (b *PatchBuilder) Or(path interface{}, predicates []Op) *PatchBuilder {
+	pointer := b.path(path)
+	return b.push(&OpOr{path: pointer, ops: b.predicates(pointer, predicates)})
+}
+
+// Not appends "not" operation, see And for predicates.
+func (b *PatchBuilder) Not(path interface{}, predicates []Op) *PatchBuilder {
+	pointer := b.path(path)
+	return b.push(&OpNot{path: pointer, ops: b.predicates(pointer, predicates)})
+}
+
+// Op appends an already constructed operation, for example one created by
+// CreateOp.
+func (b *PatchBuilder) Op(op Op) *PatchBuilder {
+	if b.err == nil && op == nil {
+		b.err = ErrOperationInvalid
+	}
+	return b.push(op)
+}
+
+// Build returns constructed operations, or the first validation error.
+func (b *PatchBuilder) Build() ([]Op, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	ops := make([]Op, len(b.ops))
+	copy(ops, b.ops)
+	return ops, nil
+}
@@ -0,0 +1,199 @@
+package jsonjoy
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JsonPatchBuilder_Build_ReturnsEmptyPatch(t *testing.T) {
+	ops, err := NewPatchBuilder().Build()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ops))
+}
+
+func Test_JsonPatchBuilder_Build_CreatesOperations(t *testing.T) {
+	ops, err := NewPatchBuilder().
+		Add("/a", 1.0).
+		Remove(JSONPointer{"b", "c"}).
+		Replace("/d", "x").
+		Move("/e", "/f").
+		Copy(JSONPointer{"f"}, "/g").
+		Test("/a", 1.0).
+		TestNot("/a", 2.0).
+		StrIns("/s", 1, "ab").
+		StrDel("/s", 0, 1).
+		StrDelString("/s", 0, "b").
+		Flip("/h").
+		Inc("/i", 5).
+		Split("/j/0", 2, nil).
+		Merge("/j/1", 2, nil).
+		Extend("/k", map[string]JSON{"l": nil}, true).
+		Defined("/a").
+		Undefined([]string{"m"}).
+		Build()
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[
+		{"op": "add", "path": "/a", "value": 1},
+		{"op": "remove", "path": "/b/c"},
+		{"op": "replace", "path": "/d", "value": "x"},
+		{"op": "move", "path": "/f", "from": "/e"},
+		{"op": "copy", "path": "/g", "from": "/f"},
+		{"op": "test", "path": "/a", "value": 1},
+		{"op": "test", "path": "/a", "value": 2, "not": true},
+		{"op": "str_ins", "path": "/s", "pos": 1, "str": "ab"},
+		{"op": "str_del", "path": "/s", "pos": 0, "len": 1},
+		{"op": "str_del", "path": "/s", "pos": 0, "str": "b"},
+		{"op": "flip", "path": "/h"},
+		{"op": "inc", "path": "/i", "inc": 5},
+		{"op": "split", "path": "/j/0", "pos": 2},
+		{"op": "merge", "path": "/j/1", "pos": 2},
+		{"op": "extend", "path": "/k", "props": {"l": null}, "deleteNull": true},
+		{"op": "defined", "path": "/a"},
+		{"op": "undefined", "path": "/m"}
+	]`), JSON(PatchToJSON(ops)))
+}
+
+func Test_JsonPatchBuilder_Build_OperationsCanBeApplied(t *testing.T) {
+	ops, err := NewPatchBuilder().
+		Add("/list/-", "c").
+		StrIns("/title", 5, " world").
+		Inc("/count", 1).
+		Move("/list/0", "/first").
+		Build()
+	assert.Nil(t, err)
+	doc := parseJSON(`{"title": "Hello", "count": 1, "list": ["a", "b"]}`)
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, parseJSON(`{"title": "Hello world", "count": 2, "list": ["b", "c"], "first": "a"}`), doc)
+}
+
+func Test_JsonPatchBuilder_Build_NormalizesValues(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+	}
+	ops, err := NewPatchBuilder().
+		Test("/a", 1).
+		Add("/b", []int{1, 2}).
+		Replace("/c", map[string]interface{}{"d": int64(3), "e": item{Name: "x"}}).
+		Extend("/f", map[string]JSON{"g": uint8(4)}, false).
+		In("/a", 1, 2).
+		Build()
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[
+		{"op": "test", "path": "/a", "value": 1},
+		{"op": "add", "path": "/b", "value": [1, 2]},
+		{"op": "replace", "path": "/c", "value": {"d": 3, "e": {"name": "x"}}},
+		{"op": "extend", "path": "/f", "props": {"g": 4}},
+		{"op": "in", "path": "/a", "value": [1, 2]}
+	]`), JSON(PatchToJSON(ops)))
+	doc := parseJSON(`{"a": 1, "c": null, "f": {}}`)
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, parseJSON(`{"a": 1, "b": [1, 2], "c": {"d": 3, "e": {"name": "x"}}, "f": {"g": 4}}`), doc)
+}
+
+func Test_JsonPatchBuilder_Build_CreatesPredicates(t *testing.T) {
+	operands, err := NewPatchBuilder().Less("/a/n", 10).Starts("/a/s", "AB", true).Build()
+	assert.Nil(t, err)
+	ops, err := NewPatchBuilder().
+		Type("/a", "object").
+		TestType("/a/n", "integer", "string").
+		Starts("/a/s", "ab", false).
+		Ends("/a/s", "C", true).
+		Contains("/a/s", "b", false).
+		Matches("/a/s", "^A", true).
+		TestString("/a/s", 1, "b").
+		TestStringNot("/a/s", 1, "x").
+		TestStringLen("/a/s", 3).
+		TestStringLenNot("/a/s", 4).
+		Less("/a/n", 10).
+		More("/a/n", 1).
+		In("/a/n", 1, 2, 3).
+		And("/a", operands).
+		Or("/a", operands).
+		Not("/a", operands[:1]).
+		Build()
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[
+		{"op": "type", "path": "/a", "value": "object"},
+		{"op": "test_type", "path": "/a/n", "type": ["integer", "string"]},
+		{"op": "starts", "path": "/a/s", "value": "ab"},
+		{"op": "ends", "path": "/a/s", "value": "C", "ignore_case": true},
+		{"op": "contains", "path": "/a/s", "value": "b"},
+		{"op": "matches", "path": "/a/s", "value": "^A", "ignore_case": true},
+		{"op": "test_string", "path": "/a/s", "pos": 1, "str": "b"},
+		{"op": "test_string", "path": "/a/s", "pos": 1, "str": "x", "not": true},
+		{"op": "test_string_len", "path": "/a/s", "len": 3},
+		{"op": "test_string_len", "path": "/a/s", "len": 4, "not": true},
+		{"op": "less", "path": "/a/n", "value": 10},
+		{"op": "more", "path": "/a/n", "value": 1},
+		{"op": "in", "path": "/a/n", "value": [1, 2, 3]},
+		{"op": "and", "path": "/a", "apply": [
+			{"op": "less", "path": "/n", "value": 10},
+			{"op": "starts", "path": "/s", "value": "AB", "ignore_case": true}
+		]},
+		{"op": "or", "path": "/a", "apply": [
+			{"op": "less", "path": "/n", "value": 10},
+			{"op": "starts", "path": "/s", "value": "AB", "ignore_case": true}
+		]},
+		{"op": "not", "path": "/a", "apply": [
+			{"op": "less", "path": "/n", "value": 10}
+		]}
+	]`), JSON(PatchToJSON(ops)))
+	doc := parseJSON(`{"a": {"n": 2, "s": "abc"}}`)
+	i, err := ApplyOpsAtomic(&doc, ops)
+	assert.Equal(t, len(ops)-1, i)
+	assert.True(t, errors.Is(err, ErrPredicate))
+	assert.Nil(t, ApplyOps(&doc, ops[:len(ops)-1]))
+}
+
+func Test_JsonPatchBuilder_Build_CopiesPointers(t *testing.T) {
+	pointer := JSONPointer{"a"}
+	ops, _ := NewPatchBuilder().Remove(pointer).Build()
+	pointer[0] = "b"
+	assert.Equal(t, JSONPointer{"a"}, ops[0].Path())
+}
+
+func Test_JsonPatchBuilder_Build_AcceptsConstructedOperations(t *testing.T) {
+	op, _ := CreateOp(parseJSON(`{"op": "less", "path": "/a", "value": 10}`))
+	ops, err := NewPatchBuilder().Op(op).Inc("/a", 1).Build()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(ops))
+	assert.Equal(t, "less", ops[0].Code())
+}
+
+func Test_JsonPatchBuilder_Build_ReturnsFirstError(t *testing.T) {
+	_, err := NewPatchBuilder().Add("a", 1).Remove(123).Build()
+	assert.Equal(t, ErrPointerInvalid, err)
+	_, err = NewPatchBuilder().Add(123, 1).Build()
+	assert.Equal(t, ErrOperationInvalidPath, err)
+	_, err = NewPatchBuilder().Move(nil, "/a").Build()
+	assert.Equal(t, ErrOperationInvalidFrom, err)
+	_, err = NewPatchBuilder().StrIns("/a", -1, "x").Build()
+	assert.Equal(t, ErrOperationInvalid, err)
+	_, err = NewPatchBuilder().StrDel("/a", 0, -1).Build()
+	assert.Equal(t, ErrOperationInvalid, err)
+	_, err = NewPatchBuilder().Extend("/a", nil, false).Build()
+	assert.Equal(t, ErrOperationInvalid, err)
+	_, err = NewPatchBuilder().Op(nil).Build()
+	assert.Equal(t, ErrOperationInvalid, err)
+	_, err = NewPatchBuilder().Add("/a", func() {}).Build()
+	assert.Equal(t, ErrOperationInvalidValue, err)
+	_, err = NewPatchBuilder().Test("/a", math.NaN()).Build()
+	assert.Equal(t, ErrOperationInvalidValue, err)
+	_, err = NewPatchBuilder().Type("/a", "float").Build()
+	assert.Equal(t, ErrOperationInvalid, err)
+	_, err = NewPatchBuilder().TestType("/a").Build()
+	assert.Equal(t, ErrOperationInvalid, err)
+	_, err = NewPatchBuilder().Matches("/a", "(", false).Build()
+	assert.Equal(t, ErrOperationInvalid, err)
+	_, err = NewPatchBuilder().TestStringLen("/a", -1).Build()
+	assert.Equal(t, ErrOperationInvalid, err)
+	remove, _ := NewPatchBuilder().Remove("/a/b").Build()
+	_, err = NewPatchBuilder().And("/a", remove).Build()
+	assert.Equal(t, ErrOperationInvalid, err)
+	defined, _ := NewPatchBuilder().Defined("/b").Build()
+	_, err = NewPatchBuilder().Or("/a", defined).Build()
+	assert.Equal(t, ErrOperationInvalidPath, err)
+}
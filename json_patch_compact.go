@@ -0,0 +1,261 @@
+package jsonjoy
+
+import (
+	"strconv"
+)
+
+// CompactOptions configure encoding of operations into compact form.
+type CompactOptions struct {
+	// TokenPointers encodes JSON Pointers as arrays of reference tokens
+	// instead of strings.
+	TokenPointers bool
+}
+
+type compactFieldKind int
+
+const (
+	// compactValue is a required field.
+	compactValue compactFieldKind = iota
+	// compactOptional is a field which is encoded as 0 when it is not set.
+	compactOptional
+	// compactFlag is a boolean field encoded as 1 or 0.
+	compactFlag
+	// compactPointer is a JSON Pointer field.
+	compactPointer
+	// compactPredicates is a list of nested predicates.
+	compactPredicates
+)
+
+type compactField struct {
+	name string
+	kind compactFieldKind
+}
+
+// compactCodec describes compact form of an operation, which is an array of
+// opcode, "path" and fields of the operation in fixed order. Trailing fields
+// which are not set are omitted.
+type compactCodec struct {
+	opcode int
+	op     string
+	fields []compactField
+}
+
+var compactCodecs = []compactCodec{
+	{0, "add", []compactField{{"value", compactValue}}},
+	{1, "remove", []compactField{{"oldValue", compactOptional}}},
+	{2, "replace", []compactField{{"value", compactValue}, {"oldValue", compactOptional}}},
+	{3, "copy", []compactField{{"from", compactPointer}}},
+	{4, "move", []compactField{{"from", compactPointer}}},
+	{5, "test", []compactField{{"value", compactValue}, {"not", compactFlag}}},
+	{6, "str_ins", []compactField{{"pos", compactValue}, {"str", compactValue}}},
+	{7, "str_del", []compactField{{"pos", compactValue}, {"str", compactOptional}, {"len", compactOptional}}},
+	{8, "flip", nil},
+	{9, "inc", []compactField{{"inc", compactValue}}},
+	{10, "split", []compactField{{"pos", compactValue}, {"props", compactOptional}}},
+	{11, "merge", []compactField{{"pos", compactValue}, {"props", compactOptional}}},
+	{12, "extend", []compactField{{"props", compactValue}, {"deleteNull", compactFlag}}},
+	{30, "contains", []compactField{{"value", compactValue}, {"ignore_case", compactFlag}}},
+	{31, "defined", nil},
+	{32, "ends", []compactField{{"value", compactValue}, {"ignore_case", compactFlag}}},
+	{33, "in", []compactField{{"value", compactValue}}},
+	{34, "less", []compactField{{"value", compactValue}}},
+	{35, "matches", []compactField{{"value", compactValue}, {"ignore_case", compactFlag}}},
+	{36, "more", []compactField{{"value", compactValue}}},
+	{37, "starts", []compactField{{"value", compactValue}, {"ignore_case", compactFlag}}},
+	{38, "test_type", []compactField{{"type", compactValue}}},
+	{39, "test_string", []compactField{{"pos", compactValue}, {"str", compactValue}, {"not", compactFlag}}},
+	{40, "test_string_len", []compactField{{"len", compactValue}, {"not", compactFlag}}},
+	{41, "type", []compactField{{"value", compactValue}}},
+	{42, "undefined", nil},
+	{43, "and", []compactField{{"apply", compactPredicates}}},
+	{44, "not", []compactField{{"apply", compactPredicates}}},
+	{45, "or", []compactField{{"apply", compactPredicates}}},
+}
+
+var compactCodecsByOpcode = map[int]*compactCodec{}
+
+var compactCodecsByOp = map[string]*compactCodec{}
+
+func init() {
+	for index := range compactCodecs {
+		codec := &compactCodecs[index]
+		compactCodecsByOpcode[codec.opcode] = codec
+		compactCodecsByOp[codec.op] = codec
+	}
+}
+
+// EncodeCompact formats a list of operations into compact form, where each
+// operation is an array starting with a numeric opcode, e.g. [0, "/foo", 1]
+// for "add" operation.
+func EncodeCompact(ops []Op, opts CompactOptions) []JSON {
+	patch := make([]JSON, len(ops))
+	for index, op := range ops {
+		patch[index] = encodeCompactOp(op.ToJSON(), &opts)
+	}
+	return patch
+}
+
+func encodeCompactOp(operation map[string]JSON, opts *CompactOptions) []JSON {
+	codec := compactCodecsByOp[operation["op"].(string)]
+	res := []JSON{float64(codec.opcode), encodeCompactPointer(operation["path"].(string), opts)}
+	last := -1
+	for index, field := range codec.fields {
+		if _, ok := operation[field.name]; ok {
+			last = index
+		}
+	}
+	for _, field := range codec.fields[:last+1] {
+		value, ok := operation[field.name]
+		if !ok {
+			res = append(res, 0.0)
+			continue
+		}
+		switch field.kind {
+		case compactFlag:
+			if value == true {
+				value = 1.0
+			} else {
+				value = 0.0
+			}
+		case compactPointer:
+			value = encodeCompactPointer(value.(string), opts)
+		case compactPredicates:
+			list := value.([]JSON)
+			predicates := make([]JSON, len(list))
+			for index, predicate := range list {
+				predicates[index] = encodeCompactOp(predicate.(map[string]JSON), opts)
+			}
+			value = predicates
+		}
+		res = append(res, value)
+	}
+	return res
+}
+
+func encodeCompactPointer(pointer string, opts *CompactOptions) JSON {
+	if !opts.TokenPointers {
+		return pointer
+	}
+	tokens, _ := NewJSONPointer(pointer)
+	res := make([]JSON, len(tokens))
+	for index, token := range tokens {
+		res[index] = token
+	}
+	return res
+}
+
+// DecodeCompact validates a list of operations in compact form and returns a
+// list of Op* structs. JSON Pointers can be strings or arrays of reference
+// tokens. Return values are the same as of CreateOps.
+func DecodeCompact(patch JSON) ([]Op, int, error) {
+	arr, ok := patch.([]JSON)
+	if !ok {
+		return nil, -1, &PatchError{Index: -1, Depth: -1, Err: ErrPatchInvalid}
+	}
+	ops := make([]Op, len(arr))
+	for index, compact := range arr {
+		operation, err := decodeCompactOp(compact)
+		if err != nil {
+			return nil, index, newValidationError(index, operation, err)
+		}
+		op, err := CreateOp(operation)
+		if err != nil {
+			return nil, index, newValidationError(index, operation, err)
+		}
+		ops[index] = op
+	}
+	return ops, -1, nil
+}
+
+// decodeCompactOp converts an operation in compact form to canonical JSON
+// form. On error, the partially decoded operation is returned.
+func decodeCompactOp(compact JSON) (map[string]JSON, error) {
+	arr, ok := compact.([]JSON)
+	if !ok || len(arr) < 2 {
+		return nil, ErrOperationInvalid
+	}
+	opcode, ok := arr[0].(float64)
+	if !ok {
+		return nil, ErrOperationInvalid
+	}
+	codec, ok := compactCodecsByOpcode[int(opcode)]
+	if !ok || float64(int(opcode)) != opcode {
+		return nil, ErrOperationUnknown
+	}
+	operation := map[string]JSON{"op": codec.op}
+	path, ok := decodeCompactPointer(arr[1])
+	if !ok {
+		return operation, ErrOperationInvalidPath
+	}
+	operation["path"] = path
+	if len(arr)-2 > len(codec.fields) {
+		return operation, ErrOperationInvalid
+	}
+	for index, value := range arr[2:] {
+		field := codec.fields[index]
+		switch field.kind {
+		case compactValue:
+			operation[field.name] = value
+		case compactOptional:
+			if value != 0.0 {
+				operation[field.name] = value
+			}
+		case compactFlag:
+			switch value {
+			case 1.0, true:
+				operation[field.name] = true
+			case 0.0, false:
+			default:
+				return operation, ErrOperationInvalid
+			}
+		case compactPointer:
+			pointer, ok := decodeCompactPointer(value)
+			if !ok {
+				return operation, ErrOperationInvalidFrom
+			}
+			operation[field.name] = pointer
+		case compactPredicates:
+			list, ok := value.([]JSON)
+			if !ok {
+				return operation, ErrOperationInvalid
+			}
+			predicates := make([]JSON, len(list))
+			for index, predicate := range list {
+				obj, err := decodeCompactOp(predicate)
+				if err != nil {
+					return operation, err
+				}
+				predicates[index] = obj
+			}
+			operation[field.name] = predicates
+		}
+	}
+	return operation, nil
+}
+
+// decodeCompactPointer returns JSON Pointer string of a pointer in compact
+// form, which is a string or an array of reference tokens. Array indices can
+// be numbers.
+func decodeCompactPointer(value JSON) (string, bool) {
+	switch pointer := value.(type) {
+	case string:
+		return pointer, true
+	case []JSON:
+		tokens := make(JSONPointer, len(pointer))
+		for index, token := range pointer {
+			switch t := token.(type) {
+			case string:
+				tokens[index] = t
+			case float64:
+				if t < 0 || t != float64(int(t)) {
+					return "", false
+				}
+				tokens[index] = strconv.Itoa(int(t))
+			default:
+				return "", false
+			}
+		}
+		return tokens.Format(), true
+	}
+	return "", false
+}
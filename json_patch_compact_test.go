@@ -0,0 +1,121 @@
+package jsonjoy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var compactPatch = `[
+	{"op": "add", "path": "/foo", "value": 1},
+	{"op": "remove", "path": "/a/0"},
+	{"op": "replace", "path": "/a", "value": {"b": null}},
+	{"op": "copy", "path": "/b", "from": "/a"},
+	{"op": "move", "path": "/c", "from": "/b/~1x"},
+	{"op": "test", "path": "/c", "value": [1], "not": true},
+	{"op": "str_ins", "path": "/s", "pos": 1, "str": "ab"},
+	{"op": "str_del", "path": "/s", "pos": 1, "len": 2},
+	{"op": "str_del", "path": "/s", "pos": 0, "str": "x"},
+	{"op": "flip", "path": "/f"},
+	{"op": "inc", "path": "/n", "inc": -1.5},
+	{"op": "split", "path": "/p/0", "pos": 2},
+	{"op": "split", "path": "/p/0", "pos": 2, "props": {"bold": true}},
+	{"op": "merge", "path": "/p/1", "pos": 3, "props": {"x": 1}},
+	{"op": "extend", "path": "/p/0", "props": {"x": null}, "deleteNull": true},
+	{"op": "contains", "path": "/s", "value": "a", "ignore_case": true},
+	{"op": "defined", "path": "/s"},
+	{"op": "ends", "path": "/s", "value": "a"},
+	{"op": "in", "path": "/n", "value": [1, 2]},
+	{"op": "less", "path": "/n", "value": 5},
+	{"op": "matches", "path": "/s", "value": "^a"},
+	{"op": "more", "path": "/n", "value": 0},
+	{"op": "starts", "path": "/s", "value": "a", "ignore_case": true},
+	{"op": "test_type", "path": "/n", "type": ["number", "null"]},
+	{"op": "test_string", "path": "/s", "pos": 1, "str": "b", "not": true},
+	{"op": "test_string_len", "path": "/s", "len": 3},
+	{"op": "type", "path": "/n", "value": "number"},
+	{"op": "undefined", "path": "/z"},
+	{"op": "and", "path": "/a", "apply": [
+		{"op": "defined", "path": "/b"},
+		{"op": "or", "path": "", "apply": [{"op": "less", "path": "/c", "value": 1}]}
+	]},
+	{"op": "not", "path": "", "apply": [{"op": "undefined", "path": "/a"}]},
+	{"op": "or", "path": "/a", "apply": [{"op": "type", "path": "/b", "value": "null"}]}
+]`
+
+func Test_JsonPatchCompact_EncodeCompact_RoundTrip(t *testing.T) {
+	ops, _, err := CreateOps(parseJSON(compactPatch))
+	assert.Nil(t, err)
+	for _, opts := range []CompactOptions{{}, {TokenPointers: true}} {
+		decoded, index, err := DecodeCompact(JSON(EncodeCompact(ops, opts)))
+		assert.Nil(t, err)
+		assert.Equal(t, -1, index)
+		assert.Equal(t, PatchToJSON(ops), PatchToJSON(decoded))
+	}
+}
+
+func Test_JsonPatchCompact_EncodeCompact(t *testing.T) {
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/foo", "value": 1},
+		{"op": "move", "path": "/a/b", "from": "/c"},
+		{"op": "test", "path": "/a", "value": 1, "not": true},
+		{"op": "str_del", "path": "/s", "pos": 1, "len": 2},
+		{"op": "not", "path": "/a", "apply": [{"op": "defined", "path": "/b"}]}
+	]`))
+	assert.Equal(t, parseJSON(`[
+		[0, "/foo", 1],
+		[4, "/a/b", "/c"],
+		[5, "/a", 1, 1],
+		[7, "/s", 1, 0, 2],
+		[44, "/a", [[31, "/b"]]]
+	]`), JSON(EncodeCompact(ops, CompactOptions{})))
+	assert.Equal(t, parseJSON(`[
+		[0, ["foo"], 1],
+		[4, ["a", "b"], ["c"]],
+		[5, ["a"], 1, 1],
+		[7, ["s"], 1, 0, 2],
+		[44, ["a"], [[31, ["b"]]]]
+	]`), JSON(EncodeCompact(ops, CompactOptions{TokenPointers: true})))
+}
+
+func Test_JsonPatchCompact_DecodeCompact(t *testing.T) {
+	ops, _, err := DecodeCompact(parseJSON(`[
+		[0, ["a", 0], {"b": 1}],
+		[1, "/c", "old value"],
+		[2, "/d", 2, 1],
+		[12, "/e", {"f": 1}, 0]
+	]`))
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[
+		{"op": "add", "path": "/a/0", "value": {"b": 1}},
+		{"op": "remove", "path": "/c"},
+		{"op": "replace", "path": "/d", "value": 2},
+		{"op": "extend", "path": "/e", "props": {"f": 1}}
+	]`), JSON(PatchToJSON(ops)))
+}
+
+func Test_JsonPatchCompact_DecodeCompact_Errors(t *testing.T) {
+	cases := []struct {
+		patch string
+		index int
+		err   error
+	}{
+		{`{}`, -1, ErrPatchInvalid},
+		{`[[0, "/a", 1], {"op": "remove", "path": "/a"}]`, 1, ErrOperationInvalid},
+		{`[[13, "/a"]]`, 0, ErrOperationUnknown},
+		{`[[1.5, "/a"]]`, 0, ErrOperationUnknown},
+		{`[[8, 1]]`, 0, ErrOperationInvalidPath},
+		{`[[8, ["a", true]]]`, 0, ErrOperationInvalidPath},
+		{`[[4, "/a", 1]]`, 0, ErrOperationInvalidFrom},
+		{`[[8, "/a", 1]]`, 0, ErrOperationInvalid},
+		{`[[5, "/a", 1, 2]]`, 0, ErrOperationInvalid},
+		{`[[2, "/a"]]`, 0, ErrOperationMissingValue},
+		{`[[43, "/a", [[99, ""]]]]`, 0, ErrOperationUnknown},
+	}
+	for _, c := range cases {
+		_, index, err := DecodeCompact(parseJSON(c.patch))
+		assert.Equal(t, c.index, index, c.patch)
+		assert.True(t, errors.Is(err, c.err), c.patch)
+	}
+}
@@ -0,0 +1,229 @@
+package jsonjoy
+
+import (
+	"math"
+)
+
+// Compose squashes a patch into an equivalent shorter one. Adjacent
+// operations on the same location are merged:
+//
+//   - "inc" operations with integer increments are summed;
+//   - "str_ins" operations are joined when the first one inserts at the start
+//     of the string, or, for positions in code points, the second one inserts
+//     right after the text inserted by the first one; other positions could
+//     be past the end of the string, where insertions are clamped, or in the
+//     middle of a UTF-16 surrogate pair, where they are moved after it;
+//   - "str_del" operations on adjacent ranges with positions in code points
+//     are joined;
+//   - "replace" followed by "remove" of the same location is replaced by the
+//     "remove";
+//   - "add" followed by "remove" of the same location is dropped when the
+//     "add" inserts an element into an array or a new key into an object
+//     written earlier in the patch;
+//   - operations which change a value written by preceding "add" or "replace"
+//     are applied to the written value.
+//
+// Composed patch consists only of operations of the same kinds as ops.
+// Other "add" followed by "remove" of the same location are kept, as whether
+// "add" inserts an element or overwrites a key is not known without the
+// document.
+// Operations are not modified, Compose returns new ones where needed.
+func Compose(ops []Op) []Op {
+	res := []Op{}
+	for _, op := range ops {
+		res = append(res, op)
+		for len(res) > 1 {
+			last := len(res) - 2
+			merged, ok := composePair(res[:last], res[last], res[last+1])
+			if !ok {
+				break
+			}
+			res = append(res[:last], merged...)
+		}
+	}
+	return res
+}
+
+// composePair merges op b applied after op a, which follows ops before,
+// returns false if they cannot be merged.
+func composePair(before []Op, a Op, b Op) ([]Op, bool) {
+	switch x := a.(type) {
+	case *OpInc:
+		if y, ok := b.(*OpInc); ok && equalPointers(x.path, y.path) && isInteger(x.inc) && isInteger(y.inc) {
+			return []Op{&OpInc{path: x.path, inc: x.inc + y.inc}}, true
+		}
+	case *OpStrIns:
+		if !equalPointers(x.path, b.Path()) || textUnit(b) != x.unit {
+			break
+		}
+		length := stringLength(x.str, x.unit)
+		switch y := b.(type) {
+		case *OpStrIns:
+			if (y.pos == x.pos+length && x.unit == PositionRunes) || (x.pos == 0 && y.pos >= 0 && y.pos <= length) {
+				str := insertString(x.str, y.pos-x.pos, y.str, x.unit)
+				return []Op{&OpStrIns{path: x.path, pos: x.pos, str: str, unit: x.unit}}, true
+			}
+		case *OpStrDel:
+			if x.pos == 0 && y.pos >= 0 && y.pos+y.len <= length &&
+				(y.str == "" || y.str == substring(x.str, y.pos, y.pos+y.len, x.unit)) {
+				str := deleteString(x.str, y.pos, y.len, x.unit)
+				return []Op{&OpStrIns{path: x.path, pos: x.pos, str: str, unit: x.unit}}, true
+			}
+		}
+	case *OpStrDel:
+		// Deletions are merged only if both or none of them verify text,
+		// deletions past the end of the string are clamped the same way
+		// before and after merging. UTF-16 positions are not merged, as they
+		// could be in the middle of a surrogate pair, where they are moved
+		// after it.
+		if y, ok := b.(*OpStrDel); ok && equalPointers(x.path, y.path) && x.unit == PositionRunes && y.unit == PositionRunes &&
+			(x.str == "") == (y.str == "") {
+			if y.pos == x.pos {
+				return []Op{&OpStrDel{path: x.path, pos: x.pos, len: x.len + y.len, str: x.str + y.str, unit: x.unit}}, true
+			}
+			if y.pos+y.len == x.pos {
+				return []Op{&OpStrDel{path: x.path, pos: y.pos, len: x.len + y.len, str: y.str + x.str, unit: x.unit}}, true
+			}
+		}
+	case *OpAdd:
+		if remove, ok := b.(*OpRemove); ok && equalPointers(x.path, remove.path) && insertsValue(before, x.path) {
+			return []Op{}, true
+		}
+		return composeWrite(x.path, x.value, b, true)
+	case *OpReplace:
+		return composeWrite(x.path, x.value, b, false)
+	}
+	return nil, false
+}
+
+// composeWrite merges op applied after value is written at path by "add", if
+// add is set, or by "replace".
+func composeWrite(path JSONPointer, value JSON, op Op, add bool) ([]Op, bool) {
+	if path.IsRoot() || path[len(path)-1] == "-" {
+		return nil, false
+	}
+	if remove, ok := op.(*OpRemove); ok && equalPointers(path, remove.path) {
+		if add {
+			return nil, false
+		}
+		return []Op{remove}, true
+	}
+	if !composesInto(path, op) {
+		return nil, false
+	}
+	var from JSONPointer
+	switch o := op.(type) {
+	case *OpMove:
+		from = append(JSONPointer{}, o.from[len(path):]...)
+	case *OpCopy:
+		from = append(JSONPointer{}, o.from[len(path):]...)
+	}
+	res := Copy(value)
+	if err := withPaths(op, append(JSONPointer{}, op.Path()[len(path):]...), from).Apply(&res); err != nil {
+		return nil, false
+	}
+	if add {
+		return []Op{&OpAdd{path: path, value: res}}, true
+	}
+	return []Op{&OpReplace{path: path, value: res}}, true
+}
+
+// insertsValue checks if "add" of path after ops inserts a new element or
+// key, so that removing it restores the document. The parent of path has to
+// be written by one of ops and not changed after that.
+func insertsValue(ops []Op, path JSONPointer) bool {
+	if path.IsRoot() {
+		return false
+	}
+	parent, ok := writtenValue(ops, path[:len(path)-1])
+	if !ok {
+		return false
+	}
+	token := path[len(path)-1]
+	switch typedParent := parent.(type) {
+	case map[string]JSON:
+		_, exists := typedParent[token]
+		return !exists
+	case []JSON:
+		_, err := ParseTokenAsArrayIndex(token, len(typedParent))
+		return err == nil
+	}
+	return false
+}
+
+// writtenValue finds the value located at path after ops, if it is written
+// by "add" or "replace" and not changed by the following operations.
+func writtenValue(ops []Op, path JSONPointer) (JSON, bool) {
+	for i := len(ops) - 1; i >= 0; i-- {
+		switch op := ops[i].(type) {
+		case PredicateOp:
+			continue
+		case *OpAdd:
+			if value, ok := valueWritten(op.path, op.value, path); ok {
+				return value, true
+			}
+		case *OpReplace:
+			if value, ok := valueWritten(op.path, op.value, path); ok {
+				return value, true
+			}
+		case *OpMove:
+			if changesValue(op.from, path) {
+				return nil, false
+			}
+		}
+		if changesValue(ops[i].Path(), path) {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// valueWritten finds the value located at path when value is written at
+// written.
+func valueWritten(written JSONPointer, value JSON, path JSONPointer) (JSON, bool) {
+	if !(equalPointers(written, path) || isPrefix(written, path)) ||
+		(!written.IsRoot() && written[len(written)-1] == "-") {
+		return nil, false
+	}
+	value, err := path[len(written):].Get(value)
+	return value, err == nil
+}
+
+// changesValue checks if an operation changing the value at changed could
+// change the value located at path, including shifting it in an array.
+func changesValue(changed JSONPointer, path JSONPointer) bool {
+	if changed.IsRoot() || equalPointers(path, changed) || isPrefix(path, changed) || isPrefix(changed, path) {
+		return true
+	}
+	token := changed[len(changed)-1]
+	if token != "-" && !isIndexToken(token) {
+		return false
+	}
+	return isPrefix(changed[:len(changed)-1], path)
+}
+
+// composesInto checks if op only reads and changes the value located at path.
+func composesInto(path JSONPointer, op Op) bool {
+	if equalPointers(path, op.Path()) {
+		switch op.(type) {
+		case *OpReplace, *OpStrIns, *OpStrDel, *OpFlip, *OpInc, *OpExtend, PredicateOp:
+			return true
+		}
+		return false
+	}
+	if !isPrefix(path, op.Path()) {
+		return false
+	}
+	switch o := op.(type) {
+	case *OpMove:
+		return isPrefix(path, o.from)
+	case *OpCopy:
+		return isPrefix(path, o.from)
+	}
+	return true
+}
+
+// isInteger checks if number has no fractional part.
+func isInteger(number float64) bool {
+	return number == math.Trunc(number) && !math.IsInf(number, 0)
+}
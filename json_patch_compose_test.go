@@ -0,0 +1,397 @@
+package jsonjoy
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var composeCases = []struct {
+	name   string
+	doc    string
+	patch  string
+	result string
+}{
+	{"counter", `{"n": 1}`, `[
+		{"op": "inc", "path": "/n", "inc": 1},
+		{"op": "inc", "path": "/n", "inc": 2},
+		{"op": "inc", "path": "/n", "inc": -1}
+	]`, `[
+		{"op": "inc", "path": "/n", "inc": 2}
+	]`},
+	{"fractional increments", `{"n": 1}`, `[
+		{"op": "inc", "path": "/n", "inc": 0.1},
+		{"op": "inc", "path": "/n", "inc": 0.2}
+	]`, `[
+		{"op": "inc", "path": "/n", "inc": 0.1},
+		{"op": "inc", "path": "/n", "inc": 0.2}
+	]`},
+	{"typing", `{"s": "ab"}`, `[
+		{"op": "str_ins", "path": "/s", "pos": 1, "str": "x"},
+		{"op": "str_ins", "path": "/s", "pos": 2, "str": "y"},
+		{"op": "str_ins", "path": "/s", "pos": 1, "str": "w"}
+	]`, `[
+		{"op": "str_ins", "path": "/s", "pos": 1, "str": "x"},
+		{"op": "str_ins", "path": "/s", "pos": 2, "str": "y"},
+		{"op": "str_ins", "path": "/s", "pos": 1, "str": "w"}
+	]`},
+	{"typing at start", `{"s": "ab"}`, `[
+		{"op": "str_ins", "path": "/s", "pos": 0, "str": "x"},
+		{"op": "str_ins", "path": "/s", "pos": 1, "str": "y"},
+		{"op": "str_ins", "path": "/s", "pos": 0, "str": "w"}
+	]`, `[
+		{"op": "str_ins", "path": "/s", "pos": 0, "str": "wxy"}
+	]`},
+	{"typing in the middle of a surrogate pair", `{"s": "a😀b"}`, `[
+		{"op": "str_ins", "path": "/s", "pos": 2, "str": "x"},
+		{"op": "str_ins", "path": "/s", "pos": 3, "str": "y"}
+	]`, `[
+		{"op": "str_ins", "path": "/s", "pos": 2, "str": "x"},
+		{"op": "str_ins", "path": "/s", "pos": 3, "str": "y"}
+	]`},
+	{"insertions past the end are kept", `{"s": "qq"}`, `[
+		{"op": "str_ins", "path": "/s", "pos": 3, "str": "XY"},
+		{"op": "str_ins", "path": "/s", "pos": 3, "str": "XY"}
+	]`, `[
+		{"op": "str_ins", "path": "/s", "pos": 3, "str": "XY"},
+		{"op": "str_ins", "path": "/s", "pos": 3, "str": "XY"}
+	]`},
+	{"UTF-16 deletions are kept", `{"s": "😀aba"}`, `[
+		{"op": "str_del", "path": "/s", "pos": 1, "len": 2},
+		{"op": "str_del", "path": "/s", "pos": 1, "len": 1}
+	]`, `[
+		{"op": "str_del", "path": "/s", "pos": 1, "len": 2},
+		{"op": "str_del", "path": "/s", "pos": 1, "len": 1}
+	]`},
+	{"typo corrected", `{"s": "ab"}`, `[
+		{"op": "str_ins", "path": "/s", "pos": 0, "str": "xyz"},
+		{"op": "str_del", "path": "/s", "pos": 1, "len": 1}
+	]`, `[
+		{"op": "str_ins", "path": "/s", "pos": 0, "str": "xz"}
+	]`},
+	{"typo past the end is kept", `{"s": "ab"}`, `[
+		{"op": "str_ins", "path": "/s", "pos": 3, "str": "xyz"},
+		{"op": "str_del", "path": "/s", "pos": 4, "len": 1}
+	]`, `[
+		{"op": "str_ins", "path": "/s", "pos": 3, "str": "xyz"},
+		{"op": "str_del", "path": "/s", "pos": 4, "len": 1}
+	]`},
+	{"mismatching verified delete is kept", `{"s": "hello"}`, `[
+		{"op": "str_ins", "path": "/s", "pos": 0, "str": "abc"},
+		{"op": "str_del", "path": "/s", "pos": 1, "str": "x"}
+	]`, `[
+		{"op": "str_ins", "path": "/s", "pos": 0, "str": "abc"},
+		{"op": "str_del", "path": "/s", "pos": 1, "str": "x"}
+	]`},
+	{"add and remove key", `{"a": 1}`, `[
+		{"op": "add", "path": "/a", "value": 2},
+		{"op": "remove", "path": "/a"}
+	]`, `[
+		{"op": "add", "path": "/a", "value": 2},
+		{"op": "remove", "path": "/a"}
+	]`},
+	{"add and remove element", `[1, 2]`, `[
+		{"op": "add", "path": "/1", "value": 3},
+		{"op": "remove", "path": "/1"}
+	]`, `[
+		{"op": "add", "path": "/1", "value": 3},
+		{"op": "remove", "path": "/1"}
+	]`},
+	{"add and remove numeric key", `{"o": {"0": 1}}`, `[
+		{"op": "add", "path": "/o/0", "value": 2},
+		{"op": "remove", "path": "/o/0"}
+	]`, `[
+		{"op": "add", "path": "/o/0", "value": 2},
+		{"op": "remove", "path": "/o/0"}
+	]`},
+	{"add and remove element of added array", `{}`, `[
+		{"op": "add", "path": "/a", "value": [1]},
+		{"op": "add", "path": "/b", "value": 0},
+		{"op": "add", "path": "/a/1", "value": 2},
+		{"op": "remove", "path": "/a/1"}
+	]`, `[
+		{"op": "add", "path": "/a", "value": [1]},
+		{"op": "add", "path": "/b", "value": 0}
+	]`},
+	{"add and remove new key of added object", `{}`, `[
+		{"op": "add", "path": "/o", "value": {"x": 1}},
+		{"op": "add", "path": "/b", "value": 0},
+		{"op": "test", "path": "/o/x", "value": 1},
+		{"op": "add", "path": "/o/k", "value": 2},
+		{"op": "remove", "path": "/o/k"}
+	]`, `[
+		{"op": "add", "path": "/o", "value": {"x": 1}},
+		{"op": "add", "path": "/b", "value": 0},
+		{"op": "test", "path": "/o/x", "value": 1}
+	]`},
+	{"add and remove existing key of added object", `{}`, `[
+		{"op": "add", "path": "/o", "value": {"k": 1}},
+		{"op": "add", "path": "/b", "value": 0},
+		{"op": "add", "path": "/o/k", "value": 2},
+		{"op": "remove", "path": "/o/k"}
+	]`, `[
+		{"op": "add", "path": "/o", "value": {"k": 1}},
+		{"op": "add", "path": "/b", "value": 0},
+		{"op": "add", "path": "/o/k", "value": 2},
+		{"op": "remove", "path": "/o/k"}
+	]`},
+	{"add and remove past the end of added array", `{}`, `[
+		{"op": "add", "path": "/a", "value": [1]},
+		{"op": "add", "path": "/b", "value": 0},
+		{"op": "add", "path": "/a/2", "value": 2},
+		{"op": "remove", "path": "/a/2"}
+	]`, `[
+		{"op": "add", "path": "/a", "value": [1]},
+		{"op": "add", "path": "/b", "value": 0},
+		{"op": "add", "path": "/a/2", "value": 2},
+		{"op": "remove", "path": "/a/2"}
+	]`},
+	{"add and remove element of moved array", `{}`, `[
+		{"op": "add", "path": "/a", "value": {"k": 1}},
+		{"op": "add", "path": "/b", "value": [0]},
+		{"op": "move", "from": "/b", "path": "/a"},
+		{"op": "add", "path": "/a/k", "value": 2},
+		{"op": "remove", "path": "/a/k"}
+	]`, `[
+		{"op": "add", "path": "/a", "value": {"k": 1}},
+		{"op": "add", "path": "/b", "value": [0]},
+		{"op": "move", "from": "/b", "path": "/a"},
+		{"op": "add", "path": "/a/k", "value": 2},
+		{"op": "remove", "path": "/a/k"}
+	]`},
+	{"add and remove element of shifted array", `{"l": [[]]}`, `[
+		{"op": "add", "path": "/l/1", "value": [7, 8]},
+		{"op": "add", "path": "/b", "value": 0},
+		{"op": "copy", "from": "/l/0", "path": "/l/0"},
+		{"op": "add", "path": "/l/1/2", "value": 9},
+		{"op": "remove", "path": "/l/1/2"}
+	]`, `[
+		{"op": "add", "path": "/l/1", "value": [7, 8]},
+		{"op": "add", "path": "/b", "value": 0},
+		{"op": "copy", "from": "/l/0", "path": "/l/0"},
+		{"op": "add", "path": "/l/1/2", "value": 9},
+		{"op": "remove", "path": "/l/1/2"}
+	]`},
+	{"replace and remove", `{"a": 1}`, `[
+		{"op": "replace", "path": "/a", "value": 2},
+		{"op": "remove", "path": "/a"}
+	]`, `[
+		{"op": "remove", "path": "/a"}
+	]`},
+	{"replace twice", `{"a": 1}`, `[
+		{"op": "replace", "path": "/a", "value": 2},
+		{"op": "replace", "path": "/a", "value": 3}
+	]`, `[
+		{"op": "replace", "path": "/a", "value": 3}
+	]`},
+	{"edits of added value", `[1]`, `[
+		{"op": "add", "path": "/0", "value": {"n": 1, "s": "a"}},
+		{"op": "inc", "path": "/0/n", "inc": 1},
+		{"op": "str_ins", "path": "/0/s", "pos": 1, "str": "b"},
+		{"op": "replace", "path": "/0", "value": {"m": [1]}},
+		{"op": "add", "path": "/0/m/0", "value": 0},
+		{"op": "move", "from": "/0/m", "path": "/0/k"}
+	]`, `[
+		{"op": "add", "path": "/0", "value": {"k": [0, 1]}}
+	]`},
+	{"edits cancel out", `{"a": 1}`, `[
+		{"op": "inc", "path": "/a", "inc": 1},
+		{"op": "add", "path": "/b", "value": "x"},
+		{"op": "str_ins", "path": "/b", "pos": 1, "str": "y"},
+		{"op": "remove", "path": "/b"},
+		{"op": "inc", "path": "/a", "inc": 2}
+	]`, `[
+		{"op": "inc", "path": "/a", "inc": 1},
+		{"op": "add", "path": "/b", "value": "xy"},
+		{"op": "remove", "path": "/b"},
+		{"op": "inc", "path": "/a", "inc": 2}
+	]`},
+	{"failing test is kept", `{}`, `[
+		{"op": "add", "path": "/a", "value": 1},
+		{"op": "test", "path": "/a", "value": 2}
+	]`, `[
+		{"op": "add", "path": "/a", "value": 1},
+		{"op": "test", "path": "/a", "value": 2}
+	]`},
+	{"append is kept", `{"a": []}`, `[
+		{"op": "add", "path": "/a/-", "value": 1},
+		{"op": "replace", "path": "/a/-", "value": 2}
+	]`, `[
+		{"op": "add", "path": "/a/-", "value": 1},
+		{"op": "replace", "path": "/a/-", "value": 2}
+	]`},
+}
+
+func Test_JsonPatchCompose_Compose_SquashesPatch(t *testing.T) {
+	for _, c := range composeCases {
+		ops, _, err := CreateOps(parseJSON(c.patch))
+		assert.Nil(t, err, c.name)
+		composed := Compose(ops)
+		assert.Equal(t, parseJSON(c.result), JSON(PatchToJSON(composed)), c.name)
+	}
+}
+
+func Test_JsonPatchCompose_Compose_PreservesSemantics(t *testing.T) {
+	for _, c := range composeCases {
+		ops, _, _ := CreateOps(parseJSON(c.patch))
+		expected := parseJSON(c.doc)
+		expectedErr := ApplyOps(&expected, ops)
+		doc := parseJSON(c.doc)
+		err := ApplyOps(&doc, Compose(ops))
+		assert.Equal(t, expectedErr == nil, err == nil, c.name)
+		if expectedErr == nil {
+			assert.Equal(t, expected, doc, c.name)
+		}
+	}
+}
+
+func Test_JsonPatchCompose_Compose_JoinsCodePointPositions(t *testing.T) {
+	cases := []struct {
+		name   string
+		docs   []string
+		patch  string
+		result string
+	}{
+		{"typing", []string{"qq", "a😀bcdef"}, `[
+			{"op": "str_ins", "path": "/s", "pos": 5, "str": "a"},
+			{"op": "str_ins", "path": "/s", "pos": 6, "str": "😀"},
+			{"op": "str_ins", "path": "/s", "pos": 7, "str": "b"}
+		]`, `[
+			{"op": "str_ins", "path": "/s", "pos": 5, "str": "a😀b"}
+		]`},
+		{"deletions past the end", []string{"hello", "h😀llo"}, `[
+			{"op": "str_del", "path": "/s", "pos": 3, "len": 5},
+			{"op": "str_del", "path": "/s", "pos": 1, "len": 2},
+			{"op": "str_del", "path": "/s", "pos": 1, "len": 3}
+		]`, `[
+			{"op": "str_del", "path": "/s", "pos": 1, "len": 10}
+		]`},
+		{"backspace and delete", []string{"hello", "he😀lo"}, `[
+			{"op": "str_del", "path": "/s", "pos": 4, "len": 1},
+			{"op": "str_del", "path": "/s", "pos": 3, "len": 1},
+			{"op": "str_del", "path": "/s", "pos": 3, "len": 1}
+		]`, `[
+			{"op": "str_del", "path": "/s", "pos": 3, "len": 3}
+		]`},
+		{"verified deletes", []string{"hello", "he😀lo"}, `[
+			{"op": "str_del", "path": "/s", "pos": 3, "str": "l"},
+			{"op": "str_del", "path": "/s", "pos": 2, "str": "l"},
+			{"op": "str_del", "path": "/s", "pos": 2, "len": 1}
+		]`, `[
+			{"op": "str_del", "path": "/s", "pos": 2, "str": "ll"},
+			{"op": "str_del", "path": "/s", "pos": 2, "len": 1}
+		]`},
+	}
+	for _, c := range cases {
+		ops, _, _ := CreateOpsWithOptions(parseJSON(c.patch), CreateOptions{PositionUnit: PositionRunes})
+		composed := Compose(ops)
+		assert.Equal(t, parseJSON(c.result), JSON(PatchToJSON(composed)), c.name)
+		for _, src := range c.docs {
+			expected := JSON(map[string]JSON{"s": src})
+			expectedErr := ApplyOps(&expected, ops)
+			doc := JSON(map[string]JSON{"s": src})
+			err := ApplyOps(&doc, composed)
+			assert.Equal(t, expectedErr == nil, err == nil, c.name+" "+src)
+			if expectedErr == nil {
+				assert.Equal(t, expected, doc, c.name+" "+src)
+			}
+		}
+	}
+}
+
+func Test_JsonPatchCompose_Compose_KeepsRFC6902Patch(t *testing.T) {
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/a", "value": 1},
+		{"op": "remove", "path": "/a"},
+		{"op": "replace", "path": "/b", "value": 1},
+		{"op": "remove", "path": "/b"}
+	]`))
+	for _, op := range Compose(ops) {
+		assert.Contains(t, RFC6902Ops(), op.Code())
+	}
+}
+
+func Test_JsonPatchCompose_Compose_DoesNotModifyOperations(t *testing.T) {
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/a", "value": {"b": 1}},
+		{"op": "inc", "path": "/a/b", "inc": 1}
+	]`))
+	Compose(ops)
+	assert.Equal(t, parseJSON(`{"b": 1}`), ops[0].(*OpAdd).Value())
+}
+
+// randomText returns a string of n characters, some of them outside of the
+// Basic Multilingual Plane.
+func randomText(r *rand.Rand, n int) string {
+	chars := []string{"a", "b", "😀"}
+	str := ""
+	for i := 0; i < n; i++ {
+		str += chars[r.Intn(len(chars))]
+	}
+	return str
+}
+
+// randomTextOps returns string operations on "/s" with positions in unit.
+func randomTextOps(r *rand.Rand, count int, unit PositionUnit) []Op {
+	ops := []Op{}
+	path := JSONPointer{"s"}
+	for i := 0; i < count; i++ {
+		switch r.Intn(3) {
+		case 0:
+			ops = append(ops, &OpStrIns{path: path, pos: r.Intn(8), str: randomText(r, 1+r.Intn(3)), unit: unit})
+		case 1:
+			ops = append(ops, &OpStrDel{path: path, pos: r.Intn(8), len: 1 + r.Intn(3), unit: unit})
+		case 2:
+			str := randomText(r, 1+r.Intn(2))
+			ops = append(ops, &OpStrDel{path: path, pos: r.Intn(8), len: stringLength(str, unit), str: str, unit: unit})
+		}
+	}
+	return ops
+}
+
+func Test_JsonPatchCompose_Compose_PreservesSemanticsOfRandomTextEdits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		src := randomText(r, r.Intn(5))
+		ops := randomTextOps(r, 3, PositionUnit(r.Intn(2)))
+		expected := JSON(map[string]JSON{"s": src})
+		expectedErr := ApplyOps(&expected, ops)
+		doc := JSON(map[string]JSON{"s": src})
+		err := ApplyOps(&doc, Compose(ops))
+		if !assert.Equal(t, expectedErr == nil, err == nil, src, PatchToJSON(ops)) {
+			return
+		}
+		if expectedErr == nil && !assert.Equal(t, expected, doc, src, PatchToJSON(ops)) {
+			return
+		}
+	}
+}
+
+func Test_JsonPatchCompose_Compose_PreservesSemanticsOfRandomPatches(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		doc := randomValue(r, 3)
+		ops := []Op{}
+		work := Copy(doc)
+		for j := r.Intn(8); j > 0; j-- {
+			op := randomOp(r, work)
+			if r.Intn(3) == 0 && len(ops) > 0 {
+				op = &OpRemove{path: ops[len(ops)-1].Path()}
+			}
+			if op.Apply(&work) == nil {
+				ops = append(ops, op)
+			}
+		}
+		expected := Copy(doc)
+		expectedErr := ApplyOps(&expected, ops)
+		actual := Copy(doc)
+		err := ApplyOps(&actual, Compose(ops))
+		if !assert.Equal(t, expectedErr == nil, err == nil, doc, PatchToJSON(ops)) {
+			return
+		}
+		if expectedErr == nil && !assert.Equal(t, expected, actual, doc, PatchToJSON(ops)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package jsonjoy
+
+import (
+	"fmt"
+)
+
+// PatchError is returned when JSON Patch validation or application fails. It
+// wraps one of the sentinel errors, which can be checked using errors.Is.
+type PatchError struct {
+	// Index of the failed operation in the patch, or -1 if error is not
+	// specific to an operation.
+	Index int
+	// Op is name of the failed operation, empty if it is not known.
+	Op string
+	// Field is "path" or "from", whichever JSON Pointer failed to resolve.
+	// Empty if error is not a resolution error.
+	Field string
+	// Pointer is the JSON Pointer which failed to resolve.
+	Pointer JSONPointer
+	// Depth is the index of the first reference token of Pointer which could
+	// not be resolved, or -1 if error is not a resolution error.
+	Depth int
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *PatchError) Error() string {
+	if e.Index < 0 {
+		return e.Err.Error()
+	}
+	msg := fmt.Sprintf("%v: operation %d", e.Err, e.Index)
+	if e.Op != "" {
+		msg += fmt.Sprintf(" (%s)", e.Op)
+	}
+	if e.Field != "" && e.Depth >= 0 && !e.Pointer.IsRoot() {
+		msg += fmt.Sprintf(", %s %q at token %d", e.Field, e.Pointer.Format(), e.Depth)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// resolvedDepth returns the index of the first reference token which cannot
+// be resolved in the document, or length of JSON Pointer if all tokens resolve.
+func resolvedDepth(doc JSON, tokens JSONPointer) int {
+	for index, token := range tokens {
+		switch container := doc.(type) {
+		case map[string]JSON:
+			child, ok := container[token]
+			if !ok {
+				return index
+			}
+			doc = child
+		case []JSON:
+			tokenIndex, err := parseElementIndex(token, len(container))
+			if err != nil {
+				return index
+			}
+			doc = container[tokenIndex]
+		default:
+			return index
+		}
+	}
+	return len(tokens)
+}
+
+// newValidationError wraps an error which happened while creating operation
+// at index.
+func newValidationError(index int, operation JSON, err error) *PatchError {
+	opName := ""
+	if obj, ok := operation.(map[string]JSON); ok {
+		opName, _ = obj["op"].(string)
+	}
+	return &PatchError{Index: index, Op: opName, Depth: -1, Err: err}
+}
+
+// opDepth holds depths to which JSON Pointers of an operation resolve in the
+// document before the operation is applied, or -1 for a missing pointer.
+type opDepth struct {
+	path int
+	from int
+}
+
+// resolveOpDepth resolves JSON Pointers of op in the document. It is called
+// after op fails, except for "move", which can remove its source before
+// failing and has to be resolved before it is applied.
+func resolveOpDepth(doc JSON, op Op) opDepth {
+	depth := opDepth{path: resolvedDepth(doc, op.Path()), from: -1}
+	switch o := op.(type) {
+	case *OpMove:
+		depth.from = resolvedDepth(doc, o.from)
+	case *OpCopy:
+		depth.from = resolvedDepth(doc, o.from)
+	}
+	return depth
+}
+
+// newApplyError wraps an error which happened while applying operation at
+// index. For resolution errors, the JSON Pointer which failed to resolve is
+// located using depth resolved in the document as it was before the
+// operation.
+func newApplyError(index int, op Op, depth opDepth, err error) *PatchError {
+	patchErr := &PatchError{Index: index, Op: op.Code(), Depth: -1, Err: err}
+	if err != ErrNotFound && err != ErrInvalidIndex {
+		return patchErr
+	}
+	var from JSONPointer
+	switch o := op.(type) {
+	case *OpMove:
+		from = o.from
+	case *OpCopy:
+		from = o.from
+	}
+	if from != nil && depth.from < len(from) {
+		patchErr.Field, patchErr.Pointer, patchErr.Depth = "from", from, depth.from
+		return patchErr
+	}
+	path := op.Path()
+	pathDepth := depth.path
+	if pathDepth == len(path) && pathDepth > 0 {
+		pathDepth--
+	}
+	patchErr.Field, patchErr.Pointer, patchErr.Depth = "path", path, pathDepth
+	return patchErr
+}
@@ -0,0 +1,121 @@
+package jsonjoy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JsonPatchError_CreateOps_ReportsOperationIndex(t *testing.T) {
+	_, index, err := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/a", "value": 1},
+		{"op": "replace", "path": "/b"}
+	]`))
+	assert.Equal(t, 1, index)
+	assert.True(t, errors.Is(err, ErrOperationMissingValue))
+	patchErr, ok := err.(*PatchError)
+	assert.True(t, ok)
+	assert.Equal(t, 1, patchErr.Index)
+	assert.Equal(t, "replace", patchErr.Op)
+	assert.Equal(t, "", patchErr.Field)
+	assert.Equal(t, -1, patchErr.Depth)
+	assert.Equal(t, "OP_VALUE_MISSING: operation 1 (replace)", err.Error())
+}
+
+func Test_JsonPatchError_CreateOps_InvalidPatch(t *testing.T) {
+	_, _, err := CreateOps(parseJSON(`{}`))
+	assert.True(t, errors.Is(err, ErrPatchInvalid))
+	assert.Equal(t, -1, err.(*PatchError).Index)
+	assert.Equal(t, "PATCH_INVALID", err.Error())
+}
+
+func Test_JsonPatchError_ApplyOps_ReportsPathDepth(t *testing.T) {
+	doc := parseJSON(`{"a": {"b": [1, 2]}}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "test", "path": "/a/b/0", "value": 1},
+		{"op": "replace", "path": "/a/b/5", "value": 3}
+	]`))
+	err := ApplyOps(&doc, ops)
+	assert.True(t, errors.Is(err, ErrInvalidIndex))
+	patchErr := err.(*PatchError)
+	assert.Equal(t, 1, patchErr.Index)
+	assert.Equal(t, "replace", patchErr.Op)
+	assert.Equal(t, "path", patchErr.Field)
+	assert.Equal(t, JSONPointer{"a", "b", "5"}, patchErr.Pointer)
+	assert.Equal(t, 2, patchErr.Depth)
+}
+
+func Test_JsonPatchError_ApplyOps_ReportsFromDepth(t *testing.T) {
+	doc := parseJSON(`{"a": {"b": 1}}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "move", "from": "/a/c/d", "path": "/e"}
+	]`))
+	err := ApplyOps(&doc, ops)
+	patchErr := err.(*PatchError)
+	assert.Equal(t, "move", patchErr.Op)
+	assert.Equal(t, "from", patchErr.Field)
+	assert.Equal(t, JSONPointer{"a", "c", "d"}, patchErr.Pointer)
+	assert.Equal(t, 1, patchErr.Depth)
+	assert.Equal(t, `NOT_FOUND: operation 0 (move), from "/a/c/d" at token 1`, err.Error())
+}
+
+func Test_JsonPatchError_ApplyOps_ReportsDepthBeforeFailedMove(t *testing.T) {
+	doc := parseJSON(`{"a": {"b": {}}}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "move", "from": "/a", "path": "/a/b/c/d"}
+	]`))
+	err := ApplyOps(&doc, ops)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	patchErr := err.(*PatchError)
+	assert.Equal(t, "path", patchErr.Field)
+	assert.Equal(t, JSONPointer{"a", "b", "c", "d"}, patchErr.Pointer)
+	assert.Equal(t, 2, patchErr.Depth)
+}
+
+func Test_JsonPatchError_ApplyOpsAtomic_ReportsDepthBeforeFailedMove(t *testing.T) {
+	doc := parseJSON(`{"a": {"b": {}}, "c": 1}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "remove", "path": "/c"},
+		{"op": "move", "from": "/a", "path": "/a/b/c/d"}
+	]`))
+	index, err := ApplyOpsAtomic(&doc, ops)
+	assert.Equal(t, 1, index)
+	patchErr := err.(*PatchError)
+	assert.Equal(t, "path", patchErr.Field)
+	assert.Equal(t, 2, patchErr.Depth)
+	assert.Equal(t, parseJSON(`{"a": {"b": {}}, "c": 1}`), doc)
+}
+
+func Test_JsonPatchError_Error_OmitsUnknownLocation(t *testing.T) {
+	err := &PatchError{Index: 0, Op: "remove", Field: "path", Pointer: JSONPointer{}, Depth: 0, Err: ErrNotFound}
+	assert.Equal(t, "NOT_FOUND: operation 0 (remove)", err.Error())
+	err = &PatchError{Index: 1, Op: "copy", Field: "from", Pointer: JSONPointer{"a"}, Depth: -1, Err: ErrNotFound}
+	assert.Equal(t, "NOT_FOUND: operation 1 (copy)", err.Error())
+}
+
+func Test_JsonPatchError_ApplyOps_WrapsTestFailure(t *testing.T) {
+	doc := parseJSON(`{"a": 1}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "test", "path": "/a", "value": 2}
+	]`))
+	err := ApplyOps(&doc, ops)
+	assert.True(t, errors.Is(err, ErrTest))
+	assert.Equal(t, ErrTest, errors.Unwrap(err))
+	assert.Equal(t, "", err.(*PatchError).Field)
+	assert.Equal(t, "TEST: operation 0 (test)", err.Error())
+}
+
+func Test_JsonPatchError_ApplyOpsAtomic_ReportsOriginalDocument(t *testing.T) {
+	doc := parseJSON(`{"a": 1}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "remove", "path": "/a"},
+		{"op": "remove", "path": "/a"}
+	]`))
+	index, err := ApplyOpsAtomic(&doc, ops)
+	assert.Equal(t, 1, index)
+	patchErr := err.(*PatchError)
+	assert.Equal(t, 1, patchErr.Index)
+	assert.Equal(t, "path", patchErr.Field)
+	assert.Equal(t, parseJSON(`{"a": 1}`), doc)
+}
@@ -0,0 +1,353 @@
+package jsonjoy
+
+import (
+	"strconv"
+)
+
+// withLastToken returns a copy of JSON Pointer with its last token replaced.
+func withLastToken(tokens JSONPointer, token string) JSONPointer {
+	res := make(JSONPointer, len(tokens))
+	copy(res, tokens)
+	res[len(res)-1] = token
+	return res
+}
+
+// isPrefix checks if JSON Pointer prefix is a strict prefix of tokens.
+func isPrefix(prefix JSONPointer, tokens JSONPointer) bool {
+	if len(prefix) >= len(tokens) {
+		return false
+	}
+	for index, token := range prefix {
+		if tokens[index] != token {
+			return false
+		}
+	}
+	return true
+}
+
+// equalPointers checks if two JSON Pointers have the same tokens.
+func equalPointers(a JSONPointer, b JSONPointer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for index, token := range a {
+		if b[index] != token {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot returns operations which restore the whole document, used when an
+// operation cannot be inverted precisely.
+func snapshot(doc JSON) []Op {
+	return []Op{&OpReplace{path: JSONPointer{}, value: Copy(doc)}}
+}
+
+// isSnapshot reports whether inverse operations restore a copy of the whole
+// document.
+func isSnapshot(inverse []Op) bool {
+	if len(inverse) != 1 {
+		return false
+	}
+	replace, ok := inverse[0].(*OpReplace)
+	return ok && replace.path.IsRoot()
+}
+
+// inverseFailedMove returns operations which undo "move" that removed the
+// value at from, but failed to add it at path.
+func inverseFailedMove(doc JSON, op *OpMove) []Op {
+	if op.from.IsRoot() {
+		return snapshot(doc)
+	}
+	value, err := op.from.Get(doc)
+	if err != nil {
+		// Nothing is removed.
+		return nil
+	}
+	return []Op{&OpAdd{path: op.from, value: value}}
+}
+
+// inverseAdd returns operations which undo adding a value at tokens.
+func inverseAdd(doc JSON, tokens JSONPointer) []Op {
+	if tokens.IsRoot() {
+		return []Op{&OpReplace{path: tokens, value: doc}}
+	}
+	parent, err := tokens[:len(tokens)-1].Get(doc)
+	if err != nil {
+		return snapshot(doc)
+	}
+	key := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]JSON:
+		if old, ok := container[key]; ok {
+			return []Op{&OpReplace{path: tokens, value: old}}
+		}
+		return []Op{&OpRemove{path: tokens}}
+	case []JSON:
+		index := len(container)
+		if key != "-" {
+			index, err = ParseTokenAsArrayIndex(key, len(container))
+			if err != nil {
+				return snapshot(doc)
+			}
+		}
+		return []Op{&OpRemove{path: withLastToken(tokens, strconv.Itoa(index))}}
+	}
+	return snapshot(doc)
+}
+
+// inverseMove returns operations which undo moving a value from one location
+// to another. Location "to" is resolved after the value was removed from its
+// original location.
+func inverseMove(doc JSON, from JSONPointer, to JSONPointer) []Op {
+	if from.IsRoot() || to.IsRoot() || isPrefix(from, to) {
+		return snapshot(doc)
+	}
+	if isPrefix(to, from) {
+		// The moved value is added over its own ancestor, which holds all of
+		// the changed state. In an array the ancestor is shifted right.
+		old, err := to.Get(doc)
+		if err != nil {
+			return snapshot(doc)
+		}
+		parent, _ := to[:len(to)-1].Get(doc)
+		if _, ok := parent.([]JSON); ok {
+			return []Op{&OpRemove{path: to}, &OpReplace{path: to, value: Copy(old)}}
+		}
+		return []Op{&OpReplace{path: to, value: Copy(old)}}
+	}
+	value, err := from.Get(doc)
+	if err != nil {
+		return snapshot(doc)
+	}
+	if equalPointers(from, to) {
+		return nil
+	}
+	fromParent := from[:len(from)-1]
+	fromKey := from[len(from)-1]
+	parent, err := fromParent.Get(doc)
+	if err != nil {
+		return snapshot(doc)
+	}
+	removedIndex := -1
+	if _, ok := parent.([]JSON); ok {
+		removedIndex, err = ParseTokenAsArrayIndex(fromKey, -1)
+		if err != nil {
+			return snapshot(doc)
+		}
+	}
+	// Convert parent of "to" to coordinates of the document before removal.
+	toParent := make(JSONPointer, len(to)-1)
+	copy(toParent, to[:len(to)-1])
+	if removedIndex > -1 && len(toParent) > len(fromParent) && equalPointers(fromParent, toParent[:len(fromParent)]) {
+		index, err := ParseTokenAsArrayIndex(toParent[len(fromParent)], -1)
+		if err == nil && index >= removedIndex {
+			toParent[len(fromParent)] = strconv.Itoa(index + 1)
+		}
+	}
+	target, err := toParent.Get(doc)
+	if err != nil {
+		return snapshot(doc)
+	}
+	sameParent := equalPointers(fromParent, toParent)
+	key := to[len(to)-1]
+	switch container := target.(type) {
+	case map[string]JSON:
+		old, ok := container[key]
+		if ok && !(sameParent && key == fromKey) {
+			return []Op{&OpReplace{path: to, value: Copy(old)}, &OpAdd{path: from, value: Copy(value)}}
+		}
+		return []Op{&OpMove{from: to, path: from}}
+	case []JSON:
+		length := len(container)
+		if sameParent {
+			length--
+		}
+		index := length
+		if key != "-" {
+			index, err = ParseTokenAsArrayIndex(key, length)
+			if err != nil {
+				return snapshot(doc)
+			}
+		}
+		return []Op{&OpMove{from: withLastToken(to, strconv.Itoa(index)), path: from}}
+	}
+	return snapshot(doc)
+}
+
+// inverseOp returns a list of operations which undo op when applied to the
+// document resulting from applying op to doc. Values captured from doc are
+// detached from the document by op, or are copied if they stay in it.
+func inverseOp(doc JSON, op Op) []Op {
+	switch o := op.(type) {
+	case PredicateOp:
+		return nil
+	case *OpAdd:
+		return inverseAdd(doc, o.path)
+	case *OpCopy:
+		if _, err := o.from.Get(doc); err != nil {
+			return snapshot(doc)
+		}
+		return inverseAdd(doc, o.path)
+	case *OpInc:
+		old, err := o.path.Get(doc)
+		if err != nil {
+			return inverseAdd(doc, o.path)
+		}
+		// Negated increment restores the value only if no precision is lost.
+		if num, ok := old.(float64); ok && (num+o.inc)-o.inc == num {
+			return []Op{&OpInc{path: o.path, inc: -o.inc}}
+		}
+		return []Op{&OpReplace{path: o.path, value: old}}
+	case *OpFlip:
+		old, err := o.path.Get(doc)
+		if err != nil {
+			return inverseAdd(doc, o.path)
+		}
+		return []Op{&OpReplace{path: o.path, value: old}}
+	case *OpReplace:
+		old, err := o.path.Get(doc)
+		if err != nil {
+			return snapshot(doc)
+		}
+		return []Op{&OpReplace{path: op.Path(), value: old}}
+	case *OpRemove:
+		old, err := o.path.Get(doc)
+		if err != nil {
+			return snapshot(doc)
+		}
+		if o.path.IsRoot() {
+			return []Op{&OpReplace{path: o.path, value: old}}
+		}
+		path := o.path
+		parent, _ := o.path[:len(o.path)-1].Get(doc)
+		if _, ok := parent.([]JSON); ok {
+			index, _ := ParseTokenAsArrayIndex(o.path[len(o.path)-1], -1)
+			path = withLastToken(o.path, strconv.Itoa(index))
+		}
+		return []Op{&OpAdd{path: path, value: old}}
+	case *OpMove:
+		return inverseMove(doc, o.from, o.path)
+	case *OpStrIns:
+		value, err := o.path.Get(doc)
+		if err != nil {
+			return inverseAdd(doc, o.path)
+		}
+		str, ok := value.(string)
+		if !ok {
+			return snapshot(doc)
+		}
+		// Position in the middle of a character is applied after it.
+		pos := stringLength(str[:stringOffset(str, o.pos, o.unit)], o.unit)
+		return []Op{&OpStrDel{path: o.path, pos: pos, len: stringLength(o.str, o.unit), unit: o.unit}}
+	case *OpStrDel:
+		value, err := o.path.Get(doc)
+		if err != nil {
+			return snapshot(doc)
+		}
+		str, ok := value.(string)
+		if !ok {
+			return snapshot(doc)
+		}
+		if o.pos >= stringLength(str, o.unit) {
+			return nil
+		}
+		return []Op{&OpStrIns{path: o.path, pos: o.pos, str: substring(str, o.pos, o.pos+o.len, o.unit), unit: o.unit}}
+	case *OpSplit:
+		old, err := o.path.Get(doc)
+		if err != nil {
+			return snapshot(doc)
+		}
+		if !o.path.IsRoot() {
+			parent, _ := o.path[:len(o.path)-1].Get(doc)
+			if _, ok := parent.([]JSON); ok {
+				index, _ := ParseTokenAsArrayIndex(o.path[len(o.path)-1], -1)
+				return []Op{
+					&OpRemove{path: withLastToken(o.path, strconv.Itoa(index+1))},
+					&OpReplace{path: withLastToken(o.path, strconv.Itoa(index)), value: Copy(old)},
+				}
+			}
+		}
+		return []Op{&OpReplace{path: o.path, value: Copy(old)}}
+	case *OpMerge:
+		if o.path.IsRoot() {
+			return snapshot(doc)
+		}
+		parent, err := o.path[:len(o.path)-1].Get(doc)
+		if err != nil {
+			return snapshot(doc)
+		}
+		arr, ok := parent.([]JSON)
+		if !ok {
+			return snapshot(doc)
+		}
+		index, err := parseElementIndex(o.path[len(o.path)-1], len(arr))
+		if err != nil || index < 1 {
+			return snapshot(doc)
+		}
+		return []Op{
+			&OpReplace{path: withLastToken(o.path, strconv.Itoa(index-1)), value: Copy(arr[index-1])},
+			&OpAdd{path: withLastToken(o.path, strconv.Itoa(index)), value: Copy(arr[index])},
+		}
+	case *OpExtend:
+		value, err := o.path.Get(doc)
+		if err != nil {
+			return snapshot(doc)
+		}
+		obj, ok := value.(map[string]JSON)
+		if !ok {
+			return snapshot(doc)
+		}
+		ops := []Op{}
+		for key, val := range o.props {
+			path := append(append(JSONPointer{}, o.path...), key)
+			old, had := obj[key]
+			exists := !(o.deleteNull && val == nil)
+			switch {
+			case had && exists:
+				ops = append(ops, &OpReplace{path: path, value: old})
+			case had:
+				ops = append(ops, &OpAdd{path: path, value: old})
+			case exists:
+				ops = append(ops, &OpRemove{path: path})
+			}
+		}
+		return ops
+	}
+	return snapshot(doc)
+}
+
+// Invert returns a patch which undoes ops when applied to the document
+// resulting from applying ops to doc. The document itself is not modified.
+// Returns *PatchError if ops cannot be applied to doc.
+func Invert(doc JSON, ops []Op) ([]Op, error) {
+	work := Copy(doc)
+	undo := make([][]Op, 0, len(ops))
+	for index, op := range ops {
+		inverse := inverseOp(work, op)
+		depth := resolveOpDepth(work, op)
+		if err := op.Apply(&work); err != nil {
+			return nil, newApplyError(index, op, depth, err)
+		}
+		undo = append(undo, inverse)
+	}
+	res := []Op{}
+	for index := len(undo) - 1; index >= 0; index-- {
+		res = append(res, undo[index]...)
+	}
+	return res, nil
+}
+
+// rollback applies recorded inverse operations in reverse order, stops at
+// the first inverse operation which fails.
+func rollback(doc *JSON, undo [][]Op) error {
+	for index := len(undo) - 1; index >= 0; index-- {
+		for _, op := range undo[index] {
+			if err := op.Apply(doc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
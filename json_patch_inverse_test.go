@@ -0,0 +1,394 @@
+package jsonjoy
+
+import (
+	"errors"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var rollbackCases = []struct {
+	name  string
+	doc   string
+	patch string
+}{
+	{"add to object", `{"a": 1}`, `[
+		{"op": "add", "path": "/b", "value": {"c": 1}},
+		{"op": "add", "path": "/a", "value": 2}
+	]`},
+	{"add to array", `{"a": [1, 2]}`, `[
+		{"op": "add", "path": "/a/0", "value": 0},
+		{"op": "add", "path": "/a/-", "value": 3},
+		{"op": "add", "path": "/a/4", "value": 4}
+	]`},
+	{"add to root", `{"a": 1}`, `[{"op": "add", "path": "", "value": [1]}]`},
+	{"remove", `{"a": [1, {"b": 2}], "c": 3}`, `[
+		{"op": "remove", "path": "/a/1/b"},
+		{"op": "remove", "path": "/a/0"},
+		{"op": "remove", "path": "/c"}
+	]`},
+	{"remove root", `[1]`, `[{"op": "remove", "path": ""}]`},
+	{"replace", `{"a": {"b": [1]}, "c": [1, 2]}`, `[
+		{"op": "replace", "path": "/a/b", "value": 2},
+		{"op": "replace", "path": "/c/1", "value": 3},
+		{"op": "replace", "path": "", "value": null}
+	]`},
+	{"move in object", `{"a": {"x": 1}, "b": 2}`, `[
+		{"op": "move", "from": "/a", "path": "/c"},
+		{"op": "move", "from": "/c", "path": "/b"},
+		{"op": "add", "path": "/b/y", "value": 2}
+	]`},
+	{"move in array", `[0, 1, 2, 3, 4]`, `[
+		{"op": "move", "from": "/0", "path": "/3"},
+		{"op": "move", "from": "/4", "path": "/0"},
+		{"op": "move", "from": "/2", "path": "/-"}
+	]`},
+	{"move between arrays", `[[1, 2], [3], 4]`, `[
+		{"op": "move", "from": "/0", "path": "/0/0"},
+		{"op": "move", "from": "/0/1", "path": "/1"},
+		{"op": "move", "from": "/2", "path": "/0/0/-"}
+	]`},
+	{"move then mutate and replace", `{"a": {"x": 1}}`, `[
+		{"op": "move", "from": "/a", "path": "/b"},
+		{"op": "add", "path": "/b/y", "value": 2},
+		{"op": "replace", "path": "/b", "value": 3}
+	]`},
+	{"move to root", `{"a": {"b": 1}}`, `[{"op": "move", "from": "/a", "path": ""}]`},
+	{"copy", `{"a": {"b": 1}, "c": []}`, `[
+		{"op": "copy", "from": "/a", "path": "/c/0"},
+		{"op": "copy", "from": "/a", "path": "/c/0/b"},
+		{"op": "copy", "from": "/c", "path": "/a"}
+	]`},
+	{"str_ins", `{"a": "hello", "b": ["x"]}`, `[
+		{"op": "str_ins", "path": "/a", "pos": 5, "str": " world"},
+		{"op": "str_ins", "path": "/a", "pos": 100, "str": "!"},
+		{"op": "str_ins", "path": "/b/0", "pos": 0, "str": "y"},
+		{"op": "str_ins", "path": "/c", "pos": 0, "str": "new"}
+	]`},
+	{"str_del", `{"a": "hello world"}`, `[
+		{"op": "str_del", "path": "/a", "pos": 0, "len": 6},
+		{"op": "str_del", "path": "/a", "pos": 3, "len": 100},
+		{"op": "str_del", "path": "/a", "pos": 50, "len": 1}
+	]`},
+	{"flip and inc", `{"a": true, "b": "x", "c": 1.5, "d": {"e": 1}, "h": {}}`, `[
+		{"op": "flip", "path": "/a"},
+		{"op": "flip", "path": "/d"},
+		{"op": "inc", "path": "/b", "inc": 1},
+		{"op": "inc", "path": "/c", "inc": 0.1},
+		{"op": "flip", "path": "/f"},
+		{"op": "inc", "path": "/h/g", "inc": 2}
+	]`},
+	{"split", `{"a": ["foobar", [1, {"x": 1}]], "b": "xy"}`, `[
+		{"op": "split", "path": "/a/0", "pos": 3},
+		{"op": "split", "path": "/a/2", "pos": 1},
+		{"op": "add", "path": "/a/3/0/y", "value": 2},
+		{"op": "replace", "path": "/a/3", "value": null},
+		{"op": "split", "path": "/b", "pos": 1}
+	]`},
+	{"merge", `[{"children": [{"x": 1}]}, {"children": [{"y": 1}]}, "a", "b"]`, `[
+		{"op": "merge", "path": "/3", "pos": 1},
+		{"op": "merge", "path": "/1", "pos": 1},
+		{"op": "add", "path": "/0/children/1/z", "value": 1},
+		{"op": "replace", "path": "/0", "value": 1}
+	]`},
+	{"extend", `{"a": {"x": 1, "y": 2}}`, `[
+		{"op": "extend", "path": "/a", "props": {"x": null, "y": 3, "z": 4, "w": null}, "deleteNull": true},
+		{"op": "extend", "path": "/a", "props": {"y": null}}
+	]`},
+	{"failing move", `{"a": {"b": 1}, "c": [1]}`, `[
+		{"op": "add", "path": "/d", "value": 1},
+		{"op": "move", "from": "/a", "path": "/c/5"}
+	]`},
+}
+
+func Test_JsonPatchInverse_ApplyOpsAtomic_RollsBackEveryOperation(t *testing.T) {
+	for _, c := range rollbackCases {
+		doc := parseJSON(c.doc)
+		original := Copy(doc)
+		ops, _, err := CreateOps(parseJSON(c.patch))
+		assert.Nil(t, err, c.name)
+		failing, _ := CreateOp(parseJSON(`{"op": "defined", "path": "/__missing__/x"}`))
+		index, err := ApplyOpsAtomic(&doc, append(ops, failing))
+		assert.NotNil(t, err, c.name)
+		assert.True(t, DeepEqual(original, doc), c.name)
+		if c.name != "failing move" {
+			assert.Equal(t, len(ops), index, c.name)
+		}
+	}
+}
+
+// removeAndFailOp removes a value and fails, which breaks inverse operations
+// recorded for preceding operations unless it is undone first.
+type removeAndFailOp struct {
+	path JSONPointer
+}
+
+func (op *removeAndFailOp) Code() string            { return "remove_and_fail" }
+func (op *removeAndFailOp) Path() JSONPointer       { return op.path }
+func (op *removeAndFailOp) ToJSON() map[string]JSON { return map[string]JSON{"op": op.Code()} }
+func (op *removeAndFailOp) Apply(doc *JSON) error {
+	Remove(doc, op.path)
+	return ErrTest
+}
+
+func Test_JsonPatchInverse_ApplyOpsAtomic_RestoresDocumentWhenOperationFailsHalfWay(t *testing.T) {
+	doc := parseJSON(`{"a": {"b": 1}, "c": [1]}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/a/d", "value": 2},
+		{"op": "add", "path": "/c/-", "value": 2}
+	]`))
+	index, err := ApplyOpsAtomic(&doc, append(ops, &removeAndFailOp{path: JSONPointer{"a"}}))
+	assert.Equal(t, 2, index)
+	assert.True(t, errors.Is(err, ErrTest))
+	assert.Equal(t, parseJSON(`{"a": {"b": 1}, "c": [1]}`), doc)
+}
+
+func Test_JsonPatchInverse_ApplyOpsAtomic_DoesNotCopyDocumentForSimpleOperations(t *testing.T) {
+	large := map[string]JSON{}
+	for i := 0; i < 1000; i++ {
+		large[strconv.Itoa(i)] = []JSON{float64(i), map[string]JSON{"x": "y"}}
+	}
+	doc := JSON(map[string]JSON{"large": large, "a": []JSON{1.0}, "b": "text"})
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/a/0", "value": 0},
+		{"op": "str_ins", "path": "/b", "pos": 0, "str": "x"},
+		{"op": "replace", "path": "/large/0/0", "value": 1},
+		{"op": "move", "from": "/a", "path": "/c"},
+		{"op": "test", "path": "/b", "value": "nope"}
+	]`))
+	allocs := testing.AllocsPerRun(10, func() {
+		index, _ := ApplyOpsAtomic(&doc, ops)
+		assert.Equal(t, 4, index)
+	})
+	assert.Less(t, allocs, float64(len(large)))
+	assert.Equal(t, 0.0, large["0"].([]JSON)[0])
+}
+
+func Test_JsonPatchInverse_InverseOp_DoesNotSnapshotDocumentForSimpleOperations(t *testing.T) {
+	doc := parseJSON(`{"a": [1, 2], "b": "text"}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/a/1", "value": 3},
+		{"op": "str_ins", "path": "/b", "pos": 0, "str": "x"},
+		{"op": "move", "from": "/a/0", "path": "/c"}
+	]`))
+	for _, op := range ops {
+		inverse := inverseOp(doc, op)
+		for _, inv := range inverse {
+			assert.False(t, inv.Path().IsRoot())
+		}
+		assert.Nil(t, op.Apply(&doc))
+	}
+}
+
+func Test_JsonPatchInverse_Invert_UndoesPatch(t *testing.T) {
+	for _, c := range rollbackCases {
+		if c.name == "failing move" {
+			continue
+		}
+		doc := parseJSON(c.doc)
+		ops, _, _ := CreateOps(parseJSON(c.patch))
+		inverse, err := Invert(doc, ops)
+		assert.Nil(t, err, c.name)
+		assert.True(t, DeepEqual(parseJSON(c.doc), doc), c.name)
+		assert.Nil(t, ApplyOps(&doc, ops), c.name)
+		assert.Nil(t, ApplyOps(&doc, inverse), c.name)
+		assert.True(t, DeepEqual(parseJSON(c.doc), doc), c.name)
+	}
+}
+
+func Test_JsonPatchInverse_Invert_ReturnsInverseOperations(t *testing.T) {
+	doc := parseJSON(`{"a": 1, "b": "hello", "c": [1, 2], "d": {"e": 1}}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "inc", "path": "/a", "inc": 2},
+		{"op": "str_ins", "path": "/b", "pos": 5, "str": "!"},
+		{"op": "str_del", "path": "/b", "pos": 0, "len": 2},
+		{"op": "remove", "path": "/c/0"},
+		{"op": "replace", "path": "/d/e", "value": 2},
+		{"op": "move", "from": "/d", "path": "/f"},
+		{"op": "add", "path": "/g", "value": null}
+	]`))
+	inverse, err := Invert(doc, ops)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[
+		{"op": "remove", "path": "/g"},
+		{"op": "move", "from": "/f", "path": "/d"},
+		{"op": "replace", "path": "/d/e", "value": 1},
+		{"op": "add", "path": "/c/0", "value": 1},
+		{"op": "str_ins", "path": "/b", "pos": 0, "str": "he"},
+		{"op": "str_del", "path": "/b", "pos": 5, "len": 1},
+		{"op": "inc", "path": "/a", "inc": -2}
+	]`), JSON(PatchToJSON(inverse)))
+}
+
+func Test_JsonPatchInverse_Invert_ReplacesImpreciseIncrement(t *testing.T) {
+	doc := parseJSON(`{"a": 0.1, "b": "x"}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "inc", "path": "/a", "inc": 1e20},
+		{"op": "inc", "path": "/b", "inc": 1}
+	]`))
+	inverse, err := Invert(doc, ops)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[
+		{"op": "replace", "path": "/b", "value": "x"},
+		{"op": "replace", "path": "/a", "value": 0.1}
+	]`), JSON(PatchToJSON(inverse)))
+}
+
+func Test_JsonPatchInverse_Invert_MoveOverAncestor(t *testing.T) {
+	for _, c := range []struct {
+		doc     string
+		patch   string
+		inverse string
+	}{
+		{`{"p": [1]}`, `[{"op": "move", "from": "/p/0", "path": "/p"}]`,
+			`[{"op": "replace", "path": "/p", "value": [1]}]`},
+		{`{"p": {"q": 1}}`, `[{"op": "move", "from": "/p/q", "path": "/p"}]`,
+			`[{"op": "replace", "path": "/p", "value": {"q": 1}}]`},
+	} {
+		doc := parseJSON(c.doc)
+		ops, _, _ := CreateOps(parseJSON(c.patch))
+		inverse, err := Invert(doc, ops)
+		assert.Nil(t, err, c.doc)
+		assert.Equal(t, parseJSON(c.inverse), JSON(PatchToJSON(inverse)), c.doc)
+		assert.Nil(t, ApplyOps(&doc, ops), c.doc)
+		assert.Nil(t, ApplyOps(&doc, inverse), c.doc)
+		assert.Equal(t, parseJSON(c.doc), doc, c.doc)
+	}
+}
+
+func Test_JsonPatchInverse_Invert_StrInsInMiddleOfSurrogatePair(t *testing.T) {
+	doc := parseJSON(`{"s": "a😀b"}`)
+	ops, _, _ := CreateOps(parseJSON(`[{"op": "str_ins", "path": "/s", "pos": 2, "str": "x"}]`))
+	inverse, err := Invert(doc, ops)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[{"op": "str_del", "path": "/s", "pos": 3, "len": 1}]`), JSON(PatchToJSON(inverse)))
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, parseJSON(`{"s": "a😀xb"}`), doc)
+	assert.Nil(t, ApplyOps(&doc, inverse))
+	assert.Equal(t, parseJSON(`{"s": "a😀b"}`), doc)
+}
+
+func Test_JsonPatchInverse_Invert_ReturnsPatchError(t *testing.T) {
+	doc := parseJSON(`{"a": 1}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "remove", "path": "/a"},
+		{"op": "remove", "path": "/a"}
+	]`))
+	inverse, err := Invert(doc, ops)
+	assert.Nil(t, inverse)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, 1, err.(*PatchError).Index)
+	assert.Equal(t, parseJSON(`{"a": 1}`), doc)
+}
+
+// randomValue returns a small random JSON value.
+func randomValue(r *rand.Rand, depth int) JSON {
+	kind := r.Intn(6)
+	if depth <= 0 {
+		kind = r.Intn(4)
+	}
+	switch kind {
+	case 0:
+		return nil
+	case 1:
+		return r.Intn(2) == 0
+	case 2:
+		return float64(r.Intn(10))
+	case 3:
+		return randomText(r, r.Intn(4))
+	case 4:
+		arr := []JSON{}
+		for i := r.Intn(3); i > 0; i-- {
+			arr = append(arr, randomValue(r, depth-1))
+		}
+		return arr
+	}
+	obj := map[string]JSON{}
+	for i := r.Intn(3); i > 0; i-- {
+		obj[string(rune('p'+r.Intn(4)))] = randomValue(r, depth-1)
+	}
+	return obj
+}
+
+// randomPointer walks doc from the root and stops at a random location, the
+// last token may point to a missing key or past the end of an array.
+func randomPointer(r *rand.Rand, doc JSON) JSONPointer {
+	pointer := JSONPointer{}
+	for r.Intn(4) != 0 {
+		switch container := doc.(type) {
+		case map[string]JSON:
+			key := string(rune('p' + r.Intn(4)))
+			pointer = append(pointer, key)
+			value, ok := container[key]
+			if !ok {
+				return pointer
+			}
+			doc = value
+		case []JSON:
+			index := r.Intn(len(container) + 1)
+			if index == len(container) {
+				if r.Intn(2) == 0 {
+					return append(pointer, "-")
+				}
+				return append(pointer, strconv.Itoa(index))
+			}
+			pointer = append(pointer, strconv.Itoa(index))
+			doc = container[index]
+		default:
+			return pointer
+		}
+	}
+	return pointer
+}
+
+// randomOp returns a random operation on locations of doc.
+func randomOp(r *rand.Rand, doc JSON) Op {
+	path := randomPointer(r, doc)
+	switch r.Intn(10) {
+	case 0, 1:
+		return &OpAdd{path: path, value: randomValue(r, 2)}
+	case 2:
+		return &OpRemove{path: path}
+	case 3:
+		return &OpReplace{path: path, value: randomValue(r, 2)}
+	case 4, 5:
+		return &OpMove{from: randomPointer(r, doc), path: path}
+	case 6:
+		return &OpCopy{from: randomPointer(r, doc), path: path}
+	case 7:
+		return &OpStrIns{path: path, pos: r.Intn(4), str: randomText(r, 1+r.Intn(2)), unit: PositionUnit(r.Intn(2))}
+	case 8:
+		return &OpStrDel{path: path, pos: r.Intn(4), len: r.Intn(3), unit: PositionUnit(r.Intn(2))}
+	}
+	return &OpInc{path: path, inc: 1}
+}
+
+func Test_JsonPatchInverse_ApplyOpsAtomic_RestoresDocumentAfterRandomFailingPatches(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	failing := &OpTest{path: JSONPointer{}, value: "never"}
+	for i := 0; i < 20000; i++ {
+		doc := randomValue(r, 3)
+		original := Copy(doc)
+		ops := []Op{}
+		work := Copy(doc)
+		for j := r.Intn(6); j > 0; j-- {
+			op := randomOp(r, work)
+			if op.Apply(&work) == nil {
+				ops = append(ops, op)
+			}
+		}
+		if r.Intn(2) == 0 {
+			// Fail at a random operation, which may change the document
+			// before failing.
+			ops = append(ops, randomOp(r, work))
+		}
+		ops = append(ops, failing)
+		index, err := ApplyOpsAtomic(&doc, ops)
+		if !assert.NotNil(t, err) || !assert.True(t, DeepEqual(original, doc), "%v", PatchToJSON(ops)) {
+			return
+		}
+		assert.NotEqual(t, -1, index)
+	}
+}
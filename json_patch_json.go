@@ -0,0 +1,160 @@
+package jsonjoy
+
+import (
+	"encoding/json"
+)
+
+// PatchToJSON formats a list of operations into canonical JSON Patch form,
+// which can be passed back to CreateOps.
+func PatchToJSON(ops []Op) []JSON {
+	patch := make([]JSON, len(ops))
+	for index, op := range ops {
+		patch[index] = op.ToJSON()
+	}
+	return patch
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpAdd) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpRemove) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpReplace) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpMove) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpCopy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpTest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpStrIns) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpStrDel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpFlip) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpInc) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpSplit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpMerge) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpExtend) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpDefined) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpUndefined) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpTestType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpStarts) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpEnds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpContains) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpMatches) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpTestString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpTestStringLen) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpLess) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpMore) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpIn) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpAnd) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpOr) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (op *OpNot) MarshalJSON() ([]byte, error) {
+	return json.Marshal(op.ToJSON())
+}
@@ -0,0 +1,53 @@
+package jsonjoy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JsonPatchJson_PatchToJSON_FormatsOperations(t *testing.T) {
+	b := []byte(`[
+		{"op": "add", "path": "/a", "value": [1, {"b": null}]},
+		{"op": "str_del", "path": "/s", "pos": 0, "len": 1},
+		{"op": "and", "path": "/x", "apply": [{"op": "less", "path": "/y", "value": 5}]}
+	]`)
+	var patch interface{}
+	json.Unmarshal(b, &patch)
+	ops, _, err := CreateOps(patch)
+	assert.Nil(t, err)
+	assert.Equal(t, patch, JSON(PatchToJSON(ops)))
+}
+
+func Test_JsonPatchJson_PatchToJSON_ResultCanBeParsedAgain(t *testing.T) {
+	b := []byte(`[
+		{"op": "replace", "path": "/a~1b/0", "value": "x"},
+		{"op": "test", "path": "/c", "value": 1, "not": true},
+		{"op": "split", "path": "/d/1", "pos": 2}
+	]`)
+	var patch interface{}
+	json.Unmarshal(b, &patch)
+	ops, _, _ := CreateOps(patch)
+	ops2, index, err := CreateOps(PatchToJSON(ops))
+	assert.Nil(t, err)
+	assert.Equal(t, -1, index)
+	assert.Equal(t, PatchToJSON(ops), PatchToJSON(ops2))
+}
+
+func Test_JsonPatchJson_MarshalJSON_SerializesOperations(t *testing.T) {
+	b := []byte(`[
+		{"op": "move", "path": "/a", "from": "/b"},
+		{"op": "inc", "path": "/n", "inc": 2},
+		{"op": "extend", "path": "", "props": {"a": 1}}
+	]`)
+	var patch interface{}
+	json.Unmarshal(b, &patch)
+	ops, _, _ := CreateOps(patch)
+	res, err := json.Marshal(ops)
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"from":"/b","op":"move","path":"/a"},{"inc":2,"op":"inc","path":"/n"},{"op":"extend","path":"","props":{"a":1}}]`, string(res))
+	res, err = json.Marshal(ops[0])
+	assert.Nil(t, err)
+	assert.Equal(t, `{"from":"/b","op":"move","path":"/a"}`, string(res))
+}
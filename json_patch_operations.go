@@ -4,6 +4,18 @@ import (
 	"errors"
 )
 
+// Op is a validated JSON Patch or JSON Patch+ operation.
+type Op interface {
+	// Code returns operation name as used in the "op" field.
+	Code() string
+	// Path returns JSON Pointer of the location targeted by the operation.
+	Path() JSONPointer
+	// Apply executes the operation on the document.
+	Apply(doc *JSON) error
+	// ToJSON returns canonical JSON form of the operation.
+	ToJSON() map[string]JSON
+}
+
 // OpAdd JSON Patch "add" operation.
 type OpAdd struct {
 	operation *map[string]JSON
@@ -52,6 +64,7 @@ type OpStrIns struct {
 	path      JSONPointer
 	pos       int
 	str       string
+	unit      PositionUnit
 }
 
 // OpStrDel JSON Patch+ "str_del" operation.
@@ -61,6 +74,7 @@ type OpStrDel struct {
 	pos       int
 	len       int
 	str       string
+	unit      PositionUnit
 }
 
 // OpFlip JSON Patch+ "flip" operation.
@@ -76,29 +90,262 @@ type OpInc struct {
 	inc       float64
 }
 
+// Code returns "add".
+func (op *OpAdd) Code() string {
+	return "add"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpAdd) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the value which is added.
+func (op *OpAdd) Value() JSON {
+	return op.value
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpAdd) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "add", "path": op.path.Format(), "value": op.value}
+}
+
+// Code returns "remove".
+func (op *OpRemove) Code() string {
+	return "remove"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpRemove) Path() JSONPointer {
+	return op.path
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpRemove) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "remove", "path": op.path.Format()}
+}
+
+// Code returns "replace".
+func (op *OpReplace) Code() string {
+	return "replace"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpReplace) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the new value.
+func (op *OpReplace) Value() JSON {
+	return op.value
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpReplace) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "replace", "path": op.path.Format(), "value": op.value}
+}
+
+// Code returns "move".
+func (op *OpMove) Code() string {
+	return "move"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpMove) Path() JSONPointer {
+	return op.path
+}
+
+// From returns the "from" of the operation.
+func (op *OpMove) From() JSONPointer {
+	return op.from
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpMove) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "move", "path": op.path.Format(), "from": op.from.Format()}
+}
+
+// Code returns "copy".
+func (op *OpCopy) Code() string {
+	return "copy"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpCopy) Path() JSONPointer {
+	return op.path
+}
+
+// From returns the "from" of the operation.
+func (op *OpCopy) From() JSONPointer {
+	return op.from
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpCopy) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "copy", "path": op.path.Format(), "from": op.from.Format()}
+}
+
+// Code returns "test".
+func (op *OpTest) Code() string {
+	return "test"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpTest) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the value which is tested for.
+func (op *OpTest) Value() JSON {
+	return op.value
+}
+
+// Not returns true if the test is negated.
+func (op *OpTest) Not() bool {
+	return op.not
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpTest) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "test", "path": op.path.Format(), "value": op.value}
+	if op.not {
+		res["not"] = true
+	}
+	return res
+}
+
+// Code returns "str_ins".
+func (op *OpStrIns) Code() string {
+	return "str_ins"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpStrIns) Path() JSONPointer {
+	return op.path
+}
+
+// Pos returns the insertion position.
+func (op *OpStrIns) Pos() int {
+	return op.pos
+}
+
+// Str returns the inserted string.
+func (op *OpStrIns) Str() string {
+	return op.str
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpStrIns) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "str_ins", "path": op.path.Format(), "pos": float64(op.pos), "str": op.str}
+}
+
+// Code returns "str_del".
+func (op *OpStrDel) Code() string {
+	return "str_del"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpStrDel) Path() JSONPointer {
+	return op.path
+}
+
+// Pos returns the deletion position.
+func (op *OpStrDel) Pos() int {
+	return op.pos
+}
+
+// Len returns the deletion length.
+func (op *OpStrDel) Len() int {
+	return op.len
+}
+
+// Str returns the deleted string, if it was specified.
+func (op *OpStrDel) Str() string {
+	return op.str
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpStrDel) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "str_del", "path": op.path.Format(), "pos": float64(op.pos)}
+	if op.str != "" {
+		res["str"] = op.str
+	} else {
+		res["len"] = float64(op.len)
+	}
+	return res
+}
+
+// Code returns "flip".
+func (op *OpFlip) Code() string {
+	return "flip"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpFlip) Path() JSONPointer {
+	return op.path
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpFlip) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "flip", "path": op.path.Format()}
+}
+
+// Code returns "inc".
+func (op *OpInc) Code() string {
+	return "inc"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpInc) Path() JSONPointer {
+	return op.path
+}
+
+// Inc returns the increment.
+func (op *OpInc) Inc() float64 {
+	return op.inc
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpInc) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "inc", "path": op.path.Format(), "inc": op.inc}
+}
+
 // ErrPatchInvalid returned when JSON Patch is invalid.
 var ErrPatchInvalid = errors.New("PATCH_INVALID")
 
 // ErrPatchEmpty returned when JSON Patch array is empty.
 var ErrPatchEmpty = errors.New("PATCH_EMPTY")
 
+// CreateOptions configure how operations are created.
+type CreateOptions struct {
+	// PositionUnit is the unit of positions and lengths of string operations
+	// and predicates.
+	PositionUnit PositionUnit
+}
+
 // CreateOps validates a list of JSON Patch operations and returns a list of
 // Op* structs. Second return argument integer represents operation in which
-// error happened, or is set to -1 if validation error did not happen in an operation.
-func CreateOps(patch JSON) ([]interface{}, int, error) {
+// error happened, or is set to -1 if validation error did not happen in an
+// operation. Returned error is a *PatchError.
+func CreateOps(patch JSON) ([]Op, int, error) {
+	return CreateOpsWithOptions(patch, CreateOptions{})
+}
+
+// CreateOpsWithOptions is like CreateOps, but uses provided options.
+func CreateOpsWithOptions(patch JSON, opts CreateOptions) ([]Op, int, error) {
 	arr, ok := patch.([]JSON)
 	if !ok {
-		return nil, -1, ErrPatchInvalid
+		return nil, -1, &PatchError{Index: -1, Depth: -1, Err: ErrPatchInvalid}
 	}
 	length := len(arr)
 	// if length == 0 {
 	// 	return nil, -1, ErrPatchEmpty
 	// }
-	ops := make([]interface{}, length)
+	ops := make([]Op, length)
 	for index, operation := range arr {
-		op, err := CreateOp(operation)
+		op, err := createOp(operation, opts.PositionUnit)
 		if err != nil {
-			return nil, index, err
+			return nil, index, newValidationError(index, operation, err)
 		}
 		ops[index] = op
 	}
@@ -112,7 +359,18 @@ var ErrOperationInvalid = errors.New("OP_INVALID")
 var ErrOperationUnknown = errors.New("OP_UNKNOWN")
 
 // CreateOp validates a single JSON Patch operation.
-func CreateOp(operation JSON) (interface{}, error) {
+func CreateOp(operation JSON) (Op, error) {
+	return createOp(operation, PositionUTF16)
+}
+
+// CreateOpWithOptions is like CreateOp, but uses provided options.
+func CreateOpWithOptions(operation JSON, opts CreateOptions) (Op, error) {
+	return createOp(operation, opts.PositionUnit)
+}
+
+// createOp validates a single JSON Patch operation, positions of string
+// operations are measured in unit.
+func createOp(operation JSON, unit PositionUnit) (Op, error) {
 	obj, ok := operation.(map[string]JSON)
 	if !ok {
 		return nil, ErrOperationInvalid
@@ -139,13 +397,51 @@ func CreateOp(operation JSON) (interface{}, error) {
 	case "test":
 		return createTestOp(obj)
 	case "str_ins":
-		return createStrInsOp(obj)
+		return createStrInsOp(obj, unit)
 	case "str_del":
-		return createStrDelOp(obj)
+		return createStrDelOp(obj, unit)
 	case "flip":
 		return createFlipOp(obj)
 	case "inc":
 		return createIncOp(obj)
+	case "split":
+		return createSplitOp(obj, unit)
+	case "merge":
+		return createMergeOp(obj)
+	case "extend":
+		return createExtendOp(obj)
+	case "defined":
+		return createDefinedOp(obj)
+	case "undefined":
+		return createUndefinedOp(obj)
+	case "type":
+		return createTypeOp(obj)
+	case "test_type":
+		return createTestTypeOp(obj)
+	case "starts":
+		return createStartsOp(obj)
+	case "ends":
+		return createEndsOp(obj)
+	case "contains":
+		return createContainsOp(obj)
+	case "matches":
+		return createMatchesOp(obj)
+	case "test_string":
+		return createTestStringOp(obj, unit)
+	case "test_string_len":
+		return createTestStringLenOp(obj, unit)
+	case "less":
+		return createLessOp(obj)
+	case "more":
+		return createMoreOp(obj)
+	case "in":
+		return createInOp(obj)
+	case "and":
+		return createAndOp(obj, unit)
+	case "or":
+		return createOrOp(obj, unit)
+	case "not":
+		return createNotOp(obj, unit)
 	default:
 		return nil, ErrOperationUnknown
 	}
@@ -157,6 +453,10 @@ var ErrOperationInvalidPath = errors.New("OP_PATH_INVALID")
 // ErrOperationMissingValue returned when operation is missing "value" field.
 var ErrOperationMissingValue = errors.New("OP_VALUE_MISSING")
 
+// ErrOperationInvalidValue returned when operation value cannot be
+// represented as JSON.
+var ErrOperationInvalidValue = errors.New("OP_VALUE_INVALID")
+
 func getPath(operation map[string]JSON) (JSONPointer, error) {
 	pathInterface, ok := operation["path"]
 	if !ok {
@@ -232,7 +532,11 @@ func createTestOp(operation map[string]JSON) (*OpTest, error) {
 	if !ok {
 		return nil, ErrOperationMissingValue
 	}
-	op := OpTest{operation: &operation, path: path, value: value}
+	not, err := getFlag(operation, "not")
+	if err != nil {
+		return nil, err
+	}
+	op := OpTest{operation: &operation, path: path, value: value, not: not}
 	return &op, nil
 }
 
@@ -314,7 +618,7 @@ func createCopyOp(operation map[string]JSON) (*OpCopy, error) {
 	return &op, nil
 }
 
-func createStrInsOp(operation map[string]JSON) (*OpStrIns, error) {
+func createStrInsOp(operation map[string]JSON, unit PositionUnit) (*OpStrIns, error) {
 	pathInterface, ok := operation["path"]
 	if !ok {
 		return nil, ErrOperationInvalidPath
@@ -327,15 +631,10 @@ func createStrInsOp(operation map[string]JSON) (*OpStrIns, error) {
 	if err != nil {
 		return nil, err
 	}
-	posInterface, ok := operation["pos"]
-	if !ok {
-		return nil, ErrOperationInvalid
-	}
-	posFloat, ok := posInterface.(float64)
-	if !ok {
-		return nil, ErrOperationInvalid
+	pos, err := getPosition(operation, "pos")
+	if err != nil {
+		return nil, err
 	}
-	pos := int(posFloat)
 	strInterface, ok := operation["str"]
 	if !ok {
 		return nil, ErrOperationInvalid
@@ -344,11 +643,11 @@ func createStrInsOp(operation map[string]JSON) (*OpStrIns, error) {
 	if !ok {
 		return nil, ErrOperationInvalid
 	}
-	op := OpStrIns{operation: &operation, path: path, pos: pos, str: str}
+	op := OpStrIns{operation: &operation, path: path, pos: pos, str: str, unit: unit}
 	return &op, nil
 }
 
-func createStrDelOp(operation map[string]JSON) (*OpStrDel, error) {
+func createStrDelOp(operation map[string]JSON, unit PositionUnit) (*OpStrDel, error) {
 	pathInterface, ok := operation["path"]
 	if !ok {
 		return nil, ErrOperationInvalidPath
@@ -361,15 +660,10 @@ func createStrDelOp(operation map[string]JSON) (*OpStrDel, error) {
 	if err != nil {
 		return nil, err
 	}
-	posInterface, ok := operation["pos"]
-	if !ok {
-		return nil, ErrOperationInvalid
-	}
-	posFloat, ok := posInterface.(float64)
-	if !ok {
-		return nil, ErrOperationInvalid
+	pos, err := getPosition(operation, "pos")
+	if err != nil {
+		return nil, err
 	}
-	pos := int(posFloat)
 	var str string = ""
 	var deletionLength int = -1
 	if lenInterface, ok := operation["len"]; ok {
@@ -391,12 +685,12 @@ func createStrDelOp(operation map[string]JSON) (*OpStrDel, error) {
 			return nil, ErrOperationInvalid
 		}
 		str = strValue
-		deletionLength = len(str)
+		deletionLength = stringLength(str, unit)
 	}
 	if deletionLength < 0 {
 		return nil, ErrOperationInvalid
 	}
-	op := OpStrDel{operation: &operation, path: path, pos: pos, len: deletionLength}
+	op := OpStrDel{operation: &operation, path: path, pos: pos, len: deletionLength, str: str, unit: unit}
 	return &op, nil
 }
 
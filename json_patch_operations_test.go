@@ -2,6 +2,7 @@ package jsonjoy
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -14,7 +15,7 @@ func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnInvalidPatch(t *testing.T)
 	json.Unmarshal(b, &doc)
 	_, index, err := CreateOps(doc)
 	assert.Equal(t, -1, index)
-	assert.Equal(t, ErrPatchInvalid, err)
+	assert.True(t, errors.Is(err, ErrPatchInvalid))
 }
 
 func Test_JsonPatchOperations_CreateOps_EmptyPatchIsNotAnError(t *testing.T) {
@@ -34,7 +35,7 @@ func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnInvalidOperation(t *testin
 	patch, _ := doc.([]JSON)
 	_, index, err := CreateOps(patch)
 	assert.Equal(t, 0, index)
-	assert.Equal(t, ErrOperationInvalid, err)
+	assert.True(t, errors.Is(err, ErrOperationInvalid))
 }
 
 func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnMissingOpField(t *testing.T) {
@@ -44,7 +45,7 @@ func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnMissingOpField(t *testing.
 	patch, _ := doc.([]JSON)
 	_, index, err := CreateOps(patch)
 	assert.Equal(t, 0, index)
-	assert.Equal(t, ErrOperationInvalid, err)
+	assert.True(t, errors.Is(err, ErrOperationInvalid))
 }
 
 func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnInvalidOpField(t *testing.T) {
@@ -54,7 +55,7 @@ func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnInvalidOpField(t *testing.
 	patch, _ := doc.([]JSON)
 	_, index, err := CreateOps(patch)
 	assert.Equal(t, 0, index)
-	assert.Equal(t, ErrOperationInvalid, err)
+	assert.True(t, errors.Is(err, ErrOperationInvalid))
 }
 
 func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnUnknownOperation(t *testing.T) {
@@ -64,7 +65,7 @@ func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnUnknownOperation(t *testin
 	patch, _ := doc.([]JSON)
 	_, index, err := CreateOps(patch)
 	assert.Equal(t, 0, index)
-	assert.Equal(t, ErrOperationUnknown, err)
+	assert.True(t, errors.Is(err, ErrOperationUnknown))
 }
 
 func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnMissingPathInAddOperation(t *testing.T) {
@@ -74,7 +75,7 @@ func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnMissingPathInAddOperation(
 	patch, _ := doc.([]JSON)
 	_, index, err := CreateOps(patch)
 	assert.Equal(t, 0, index)
-	assert.Equal(t, ErrOperationInvalidPath, err)
+	assert.True(t, errors.Is(err, ErrOperationInvalidPath))
 }
 
 func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnInvalidAddOperationPath(t *testing.T) {
@@ -84,7 +85,7 @@ func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnInvalidAddOperationPath(t
 	patch, _ := doc.([]JSON)
 	_, index, err := CreateOps(patch)
 	assert.Equal(t, 0, index)
-	assert.Equal(t, ErrOperationInvalidPath, err)
+	assert.True(t, errors.Is(err, ErrOperationInvalidPath))
 }
 
 func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnInvalidAddOperationPathPointer(t *testing.T) {
@@ -94,7 +95,7 @@ func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnInvalidAddOperationPathPoi
 	patch, _ := doc.([]JSON)
 	_, index, err := CreateOps(patch)
 	assert.Equal(t, 0, index)
-	assert.Equal(t, ErrPointerInvalid, err)
+	assert.True(t, errors.Is(err, ErrPointerInvalid))
 }
 
 func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnAddOperationMissingValueField(t *testing.T) {
@@ -104,7 +105,7 @@ func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnAddOperationMissingValueFi
 	patch, _ := doc.([]JSON)
 	_, index, err := CreateOps(patch)
 	assert.Equal(t, 0, index)
-	assert.Equal(t, ErrOperationMissingValue, err)
+	assert.True(t, errors.Is(err, ErrOperationMissingValue))
 }
 
 func Test_JsonPatchOperations_CreateOps_ReturnsAddOpOnSuccess(t *testing.T) {
@@ -187,3 +188,130 @@ func Test_JsonPatchOperations_CreateOps_CanCreateMultipleOperations(t *testing.T
 	assert.Equal(t, "3", op6.from[0])
 	assert.Equal(t, "4", op6.from[1])
 }
+
+func Test_JsonPatchOperations_CreateOps_ReadsNotFlagOfTestOperation(t *testing.T) {
+	b := []byte(`[
+		{"op": "test", "path": "/a", "value": 1},
+		{"op": "test", "path": "/a", "value": 1, "not": true}
+	]`)
+	var doc interface{}
+	json.Unmarshal(b, &doc)
+	ops, index, err := CreateOps(doc)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, index)
+	op1, _ := ops[0].(*OpTest)
+	assert.Equal(t, false, op1.not)
+	op2, _ := ops[1].(*OpTest)
+	assert.Equal(t, true, op2.not)
+}
+
+func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnInvalidNotFlag(t *testing.T) {
+	b := []byte(`[
+		{"op": "add", "path": "/a", "value": 1},
+		{"op": "test", "path": "/a", "value": 1, "not": "yes"}
+	]`)
+	var doc interface{}
+	json.Unmarshal(b, &doc)
+	_, index, err := CreateOps(doc)
+	assert.Equal(t, 1, index)
+	assert.True(t, errors.Is(err, ErrOperationInvalid))
+}
+
+func Test_JsonPatchOperations_CreateOps_ReturnsErrorOnNegativeStringPosition(t *testing.T) {
+	for _, patch := range []string{
+		`[{"op": "str_ins", "path": "/a", "pos": -1, "str": "x"}]`,
+		`[{"op": "str_del", "path": "/a", "pos": -1, "len": 1}]`,
+	} {
+		_, index, err := CreateOps(parseJSON(patch))
+		assert.Equal(t, 0, index, patch)
+		assert.True(t, errors.Is(err, ErrOperationInvalid), patch)
+	}
+}
+
+func Test_JsonPatchOperations_Op_ExposesCodePathAndFields(t *testing.T) {
+	b := []byte(`[
+		{"op": "add", "path": "/a", "value": 1},
+		{"op": "move", "path": "/b", "from": "/a"},
+		{"op": "str_ins", "path": "/s", "pos": 2, "str": "x"},
+		{"op": "str_del", "path": "/s", "pos": 1, "len": 3},
+		{"op": "inc", "path": "/n", "inc": -2}
+	]`)
+	var doc interface{}
+	json.Unmarshal(b, &doc)
+	ops, _, err := CreateOps(doc)
+	assert.Nil(t, err)
+	codes := make([]string, len(ops))
+	for index, op := range ops {
+		codes[index] = op.Code()
+	}
+	assert.Equal(t, []string{"add", "move", "str_ins", "str_del", "inc"}, codes)
+	assert.Equal(t, JSONPointer{"a"}, ops[0].Path())
+	assert.Equal(t, 1.0, ops[0].(*OpAdd).Value())
+	assert.Equal(t, JSONPointer{"a"}, ops[1].(*OpMove).From())
+	assert.Equal(t, 2, ops[2].(*OpStrIns).Pos())
+	assert.Equal(t, "x", ops[2].(*OpStrIns).Str())
+	assert.Equal(t, 3, ops[3].(*OpStrDel).Len())
+	assert.Equal(t, -2.0, ops[4].(*OpInc).Inc())
+}
+
+func Test_JsonPatchOperations_Op_ToJSONReturnsCanonicalOperation(t *testing.T) {
+	operations := []string{
+		`{"op": "add", "path": "/a/b", "value": {"c": [1]}}`,
+		`{"op": "remove", "path": "/a~1b"}`,
+		`{"op": "replace", "path": "", "value": null}`,
+		`{"op": "move", "path": "/a", "from": "/b/0"}`,
+		`{"op": "copy", "path": "/a", "from": "/b"}`,
+		`{"op": "test", "path": "/a", "value": "x"}`,
+		`{"op": "test", "path": "/a", "value": "x", "not": true}`,
+		`{"op": "str_ins", "path": "/a", "pos": 1, "str": "x"}`,
+		`{"op": "str_del", "path": "/a", "pos": 1, "len": 2}`,
+		`{"op": "flip", "path": "/a"}`,
+		`{"op": "inc", "path": "/a", "inc": 1.5}`,
+		`{"op": "split", "path": "/a/0", "pos": 1, "props": {"bold": true}}`,
+		`{"op": "merge", "path": "/a/1", "pos": 3}`,
+		`{"op": "extend", "path": "/a", "props": {"b": null}, "deleteNull": true}`,
+		`{"op": "defined", "path": "/a"}`,
+		`{"op": "undefined", "path": "/a"}`,
+		`{"op": "type", "path": "/a", "value": "integer"}`,
+		`{"op": "test_type", "path": "/a", "type": ["string", "null"]}`,
+		`{"op": "starts", "path": "/a", "value": "x", "ignore_case": true}`,
+		`{"op": "ends", "path": "/a", "value": "x"}`,
+		`{"op": "contains", "path": "/a", "value": "x"}`,
+		`{"op": "matches", "path": "/a", "value": "^x$"}`,
+		`{"op": "test_string", "path": "/a", "pos": 1, "str": "x", "not": true}`,
+		`{"op": "test_string_len", "path": "/a", "len": 3}`,
+		`{"op": "less", "path": "/a", "value": 3}`,
+		`{"op": "more", "path": "/a", "value": 3}`,
+		`{"op": "in", "path": "/a", "value": [1, "2"]}`,
+		`{"op": "and", "path": "/a", "apply": [
+			{"op": "defined", "path": "/b"},
+			{"op": "not", "path": "/c", "apply": [{"op": "test", "path": "", "value": 1}]}
+		]}`,
+		`{"op": "or", "path": "", "apply": [{"op": "defined", "path": "/b"}]}`,
+	}
+	for _, operation := range operations {
+		var obj interface{}
+		json.Unmarshal([]byte(operation), &obj)
+		op, err := CreateOp(obj)
+		assert.Nil(t, err, operation)
+		assert.Equal(t, obj, JSON(op.ToJSON()), operation)
+	}
+}
+
+func Test_JsonPatchOperations_Op_CanBeWrappedByMiddleware(t *testing.T) {
+	b := []byte(`[
+		{"op": "add", "path": "/a", "value": 1},
+		{"op": "remove", "path": "/secret"}
+	]`)
+	var patch interface{}
+	json.Unmarshal(b, &patch)
+	ops, _, _ := CreateOps(patch)
+	var doc JSON = map[string]JSON{"secret": true}
+	for _, op := range ops {
+		if op.Code() == "remove" && op.Path().Format() == "/secret" {
+			continue
+		}
+		assert.Nil(t, ApplyOperation(&doc, op))
+	}
+	assert.Equal(t, map[string]JSON{"a": 1.0, "secret": true}, doc)
+}
@@ -0,0 +1,1155 @@
+package jsonjoy
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// ErrPredicate is returned when a JSON Patch+ predicate operation was not passed.
+var ErrPredicate = errors.New("PREDICATE")
+
+// PredicateOp is implemented by operations which only test the document and
+// never modify it.
+type PredicateOp interface {
+	Op
+	// Test checks if predicate holds for the document.
+	Test(doc JSON) (bool, error)
+}
+
+// OpDefined JSON Patch+ "defined" operation.
+type OpDefined struct {
+	operation *map[string]JSON
+	path      JSONPointer
+}
+
+// OpUndefined JSON Patch+ "undefined" operation.
+type OpUndefined struct {
+	operation *map[string]JSON
+	path      JSONPointer
+}
+
+// OpType JSON Patch+ "type" operation.
+type OpType struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	value     string
+}
+
+// OpTestType JSON Patch+ "test_type" operation.
+type OpTestType struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	types     []string
+}
+
+var jsonTypes = map[string]bool{
+	"null":    true,
+	"integer": true,
+	"number":  true,
+	"string":  true,
+	"boolean": true,
+	"array":   true,
+	"object":  true,
+}
+
+// isType checks if JSON value is of type typ, integers are also numbers.
+func isType(value JSON, typ string) bool {
+	switch val := value.(type) {
+	case nil:
+		return typ == "null"
+	case float64:
+		if typ == "number" {
+			return true
+		}
+		return typ == "integer" && val == math.Trunc(val) && !math.IsInf(val, 0)
+	case string:
+		return typ == "string"
+	case bool:
+		return typ == "boolean"
+	case []JSON:
+		return typ == "array"
+	case map[string]JSON:
+		return typ == "object"
+	}
+	return false
+}
+
+func applyPredicate(doc *JSON, op PredicateOp) error {
+	ok, err := op.Test(*doc)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrPredicate
+	}
+	return nil
+}
+
+func (op *OpTest) Test(doc JSON) (bool, error) {
+	target, err := op.path.Get(doc)
+	if op.not && unresolved(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return DeepEqual(op.value, target) != op.not, nil
+}
+
+func (op *OpDefined) Test(doc JSON) (bool, error) {
+	_, err := op.path.Get(doc)
+	return err == nil, nil
+}
+
+func (op *OpDefined) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpUndefined) Test(doc JSON) (bool, error) {
+	_, err := op.path.Get(doc)
+	return err != nil, nil
+}
+
+func (op *OpUndefined) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpType) Test(doc JSON) (bool, error) {
+	target, err := op.path.Get(doc)
+	if err != nil {
+		return false, err
+	}
+	return isType(target, op.value), nil
+}
+
+func (op *OpType) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpTestType) Test(doc JSON) (bool, error) {
+	target, err := op.path.Get(doc)
+	if err != nil {
+		return false, err
+	}
+	for _, typ := range op.types {
+		if isType(target, typ) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (op *OpTestType) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func createDefinedOp(operation map[string]JSON) (*OpDefined, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	op := OpDefined{operation: &operation, path: path}
+	return &op, nil
+}
+
+func createUndefinedOp(operation map[string]JSON) (*OpUndefined, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	op := OpUndefined{operation: &operation, path: path}
+	return &op, nil
+}
+
+func createTypeOp(operation map[string]JSON) (*OpType, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	valueInterface, ok := operation["value"]
+	if !ok {
+		return nil, ErrOperationMissingValue
+	}
+	value, ok := valueInterface.(string)
+	if !ok || !jsonTypes[value] {
+		return nil, ErrOperationInvalid
+	}
+	op := OpType{operation: &operation, path: path, value: value}
+	return &op, nil
+}
+
+func createTestTypeOp(operation map[string]JSON) (*OpTestType, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	typeInterface, ok := operation["type"]
+	if !ok {
+		return nil, ErrOperationInvalid
+	}
+	list, ok := typeInterface.([]JSON)
+	if !ok || len(list) == 0 {
+		return nil, ErrOperationInvalid
+	}
+	types := make([]string, len(list))
+	for index, item := range list {
+		typ, ok := item.(string)
+		if !ok || !jsonTypes[typ] {
+			return nil, ErrOperationInvalid
+		}
+		types[index] = typ
+	}
+	op := OpTestType{operation: &operation, path: path, types: types}
+	return &op, nil
+}
+
+// OpStarts JSON Patch+ "starts" operation.
+type OpStarts struct {
+	operation  *map[string]JSON
+	path       JSONPointer
+	value      string
+	ignoreCase bool
+}
+
+// OpEnds JSON Patch+ "ends" operation.
+type OpEnds struct {
+	operation  *map[string]JSON
+	path       JSONPointer
+	value      string
+	ignoreCase bool
+}
+
+// OpContains JSON Patch+ "contains" operation.
+type OpContains struct {
+	operation  *map[string]JSON
+	path       JSONPointer
+	value      string
+	ignoreCase bool
+}
+
+// OpMatches JSON Patch+ "matches" operation.
+type OpMatches struct {
+	operation  *map[string]JSON
+	path       JSONPointer
+	value      string
+	ignoreCase bool
+	regexp     *regexp.Regexp
+}
+
+// OpTestString JSON Patch+ "test_string" operation.
+type OpTestString struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	pos       int
+	str       string
+	not       bool
+	unit      PositionUnit
+}
+
+// OpTestStringLen JSON Patch+ "test_string_len" operation.
+type OpTestStringLen struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	len       int
+	not       bool
+	unit      PositionUnit
+}
+
+// OpLess JSON Patch+ "less" operation.
+type OpLess struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	value     float64
+}
+
+// OpMore JSON Patch+ "more" operation.
+type OpMore struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	value     float64
+}
+
+// OpIn JSON Patch+ "in" operation.
+type OpIn struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	value     []JSON
+}
+
+// getString returns target string of a string predicate, ok is false if
+// the target is not a string.
+func getString(doc JSON, path JSONPointer) (str string, ok bool, err error) {
+	target, err := path.Get(doc)
+	if err != nil {
+		return "", false, err
+	}
+	str, ok = target.(string)
+	return str, ok, nil
+}
+
+func (op *OpStarts) Test(doc JSON) (bool, error) {
+	str, ok, err := getString(doc, op.path)
+	if !ok {
+		return false, err
+	}
+	if op.ignoreCase {
+		return strings.HasPrefix(strings.ToLower(str), strings.ToLower(op.value)), nil
+	}
+	return strings.HasPrefix(str, op.value), nil
+}
+
+func (op *OpStarts) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpEnds) Test(doc JSON) (bool, error) {
+	str, ok, err := getString(doc, op.path)
+	if !ok {
+		return false, err
+	}
+	if op.ignoreCase {
+		return strings.HasSuffix(strings.ToLower(str), strings.ToLower(op.value)), nil
+	}
+	return strings.HasSuffix(str, op.value), nil
+}
+
+func (op *OpEnds) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpContains) Test(doc JSON) (bool, error) {
+	str, ok, err := getString(doc, op.path)
+	if !ok {
+		return false, err
+	}
+	if op.ignoreCase {
+		return strings.Contains(strings.ToLower(str), strings.ToLower(op.value)), nil
+	}
+	return strings.Contains(str, op.value), nil
+}
+
+func (op *OpContains) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpMatches) Test(doc JSON) (bool, error) {
+	str, ok, err := getString(doc, op.path)
+	if !ok {
+		return false, err
+	}
+	return op.regexp.MatchString(str), nil
+}
+
+func (op *OpMatches) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpTestString) Test(doc JSON) (bool, error) {
+	str, ok, err := getString(doc, op.path)
+	if !ok {
+		return false, err
+	}
+	return (substring(str, op.pos, op.pos+stringLength(op.str, op.unit), op.unit) == op.str) != op.not, nil
+}
+
+func (op *OpTestString) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpTestStringLen) Test(doc JSON) (bool, error) {
+	str, ok, err := getString(doc, op.path)
+	if !ok {
+		return false, err
+	}
+	return (stringLength(str, op.unit) >= op.len) != op.not, nil
+}
+
+func (op *OpTestStringLen) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+// getNumber returns target number of a numeric predicate, ok is false if
+// the target is not a number.
+func getNumber(doc JSON, path JSONPointer) (num float64, ok bool, err error) {
+	target, err := path.Get(doc)
+	if err != nil {
+		return 0, false, err
+	}
+	num, ok = target.(float64)
+	return num, ok, nil
+}
+
+func (op *OpLess) Test(doc JSON) (bool, error) {
+	num, ok, err := getNumber(doc, op.path)
+	if !ok {
+		return false, err
+	}
+	return num < op.value, nil
+}
+
+func (op *OpLess) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpMore) Test(doc JSON) (bool, error) {
+	num, ok, err := getNumber(doc, op.path)
+	if !ok {
+		return false, err
+	}
+	return num > op.value, nil
+}
+
+func (op *OpMore) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpIn) Test(doc JSON) (bool, error) {
+	target, err := op.path.Get(doc)
+	if err != nil {
+		return false, err
+	}
+	for _, value := range op.value {
+		if DeepEqual(value, target) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (op *OpIn) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+// getFlag reads an optional boolean field of an operation.
+func getFlag(operation map[string]JSON, key string) (bool, error) {
+	flagInterface, ok := operation[key]
+	if !ok {
+		return false, nil
+	}
+	flag, ok := flagInterface.(bool)
+	if !ok {
+		return false, ErrOperationInvalid
+	}
+	return flag, nil
+}
+
+// getPosition reads a non-negative integer field of an operation.
+func getPosition(operation map[string]JSON, key string) (int, error) {
+	posInterface, ok := operation[key]
+	if !ok {
+		return 0, ErrOperationInvalid
+	}
+	posFloat, ok := posInterface.(float64)
+	if !ok || posFloat < 0 {
+		return 0, ErrOperationInvalid
+	}
+	return int(posFloat), nil
+}
+
+// getStringPredicate reads fields common to "starts", "ends", "contains" and
+// "matches" operations.
+func getStringPredicate(operation map[string]JSON) (JSONPointer, string, bool, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, "", false, err
+	}
+	valueInterface, ok := operation["value"]
+	if !ok {
+		return nil, "", false, ErrOperationMissingValue
+	}
+	value, ok := valueInterface.(string)
+	if !ok {
+		return nil, "", false, ErrOperationInvalid
+	}
+	ignoreCase, err := getFlag(operation, "ignore_case")
+	if err != nil {
+		return nil, "", false, err
+	}
+	return path, value, ignoreCase, nil
+}
+
+func createStartsOp(operation map[string]JSON) (*OpStarts, error) {
+	path, value, ignoreCase, err := getStringPredicate(operation)
+	if err != nil {
+		return nil, err
+	}
+	op := OpStarts{operation: &operation, path: path, value: value, ignoreCase: ignoreCase}
+	return &op, nil
+}
+
+func createEndsOp(operation map[string]JSON) (*OpEnds, error) {
+	path, value, ignoreCase, err := getStringPredicate(operation)
+	if err != nil {
+		return nil, err
+	}
+	op := OpEnds{operation: &operation, path: path, value: value, ignoreCase: ignoreCase}
+	return &op, nil
+}
+
+func createContainsOp(operation map[string]JSON) (*OpContains, error) {
+	path, value, ignoreCase, err := getStringPredicate(operation)
+	if err != nil {
+		return nil, err
+	}
+	op := OpContains{operation: &operation, path: path, value: value, ignoreCase: ignoreCase}
+	return &op, nil
+}
+
+func createMatchesOp(operation map[string]JSON) (*OpMatches, error) {
+	path, value, ignoreCase, err := getStringPredicate(operation)
+	if err != nil {
+		return nil, err
+	}
+	expr := value
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, ErrOperationInvalid
+	}
+	op := OpMatches{operation: &operation, path: path, value: value, ignoreCase: ignoreCase, regexp: re}
+	return &op, nil
+}
+
+func createTestStringOp(operation map[string]JSON, unit PositionUnit) (*OpTestString, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := getPosition(operation, "pos")
+	if err != nil {
+		return nil, err
+	}
+	strInterface, ok := operation["str"]
+	if !ok {
+		return nil, ErrOperationInvalid
+	}
+	str, ok := strInterface.(string)
+	if !ok {
+		return nil, ErrOperationInvalid
+	}
+	not, err := getFlag(operation, "not")
+	if err != nil {
+		return nil, err
+	}
+	op := OpTestString{operation: &operation, path: path, pos: pos, str: str, not: not, unit: unit}
+	return &op, nil
+}
+
+func createTestStringLenOp(operation map[string]JSON, unit PositionUnit) (*OpTestStringLen, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	length, err := getPosition(operation, "len")
+	if err != nil {
+		return nil, err
+	}
+	not, err := getFlag(operation, "not")
+	if err != nil {
+		return nil, err
+	}
+	op := OpTestStringLen{operation: &operation, path: path, len: length, not: not, unit: unit}
+	return &op, nil
+}
+
+// getNumericPredicate reads fields of "less" and "more" operations.
+func getNumericPredicate(operation map[string]JSON) (JSONPointer, float64, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, 0, err
+	}
+	valueInterface, ok := operation["value"]
+	if !ok {
+		return nil, 0, ErrOperationMissingValue
+	}
+	value, ok := valueInterface.(float64)
+	if !ok {
+		return nil, 0, ErrOperationInvalid
+	}
+	return path, value, nil
+}
+
+func createLessOp(operation map[string]JSON) (*OpLess, error) {
+	path, value, err := getNumericPredicate(operation)
+	if err != nil {
+		return nil, err
+	}
+	op := OpLess{operation: &operation, path: path, value: value}
+	return &op, nil
+}
+
+func createMoreOp(operation map[string]JSON) (*OpMore, error) {
+	path, value, err := getNumericPredicate(operation)
+	if err != nil {
+		return nil, err
+	}
+	op := OpMore{operation: &operation, path: path, value: value}
+	return &op, nil
+}
+
+func createInOp(operation map[string]JSON) (*OpIn, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	valueInterface, ok := operation["value"]
+	if !ok {
+		return nil, ErrOperationMissingValue
+	}
+	value, ok := valueInterface.([]JSON)
+	if !ok {
+		return nil, ErrOperationInvalid
+	}
+	op := OpIn{operation: &operation, path: path, value: value}
+	return &op, nil
+}
+
+// OpAnd JSON Patch+ "and" operation, passes when all of its predicates pass.
+type OpAnd struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	ops       []PredicateOp
+}
+
+// OpOr JSON Patch+ "or" operation, passes when any of its predicates passes.
+type OpOr struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	ops       []PredicateOp
+}
+
+// OpNot JSON Patch+ "not" operation, passes when none of its predicates pass.
+type OpNot struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	ops       []PredicateOp
+}
+
+// testOperand tests a predicate of a composite operation, a location which
+// cannot be resolved fails the predicate instead of the whole operation.
+func testOperand(predicate PredicateOp, doc JSON) (bool, error) {
+	ok, err := predicate.Test(doc)
+	if unresolved(err) {
+		return false, nil
+	}
+	return ok, err
+}
+
+func (op *OpAnd) Test(doc JSON) (bool, error) {
+	for _, predicate := range op.ops {
+		ok, err := testOperand(predicate, doc)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (op *OpAnd) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpOr) Test(doc JSON) (bool, error) {
+	for _, predicate := range op.ops {
+		ok, err := testOperand(predicate, doc)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (op *OpOr) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+func (op *OpNot) Test(doc JSON) (bool, error) {
+	for _, predicate := range op.ops {
+		ok, err := testOperand(predicate, doc)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (op *OpNot) Apply(doc *JSON) error {
+	return applyPredicate(doc, op)
+}
+
+// getPredicates creates predicate operations listed in the "apply" field of a
+// composite operation. Paths of the listed operations are relative to path,
+// their string positions are measured in unit.
+func getPredicates(operation map[string]JSON, path JSONPointer, unit PositionUnit) ([]PredicateOp, error) {
+	applyInterface, ok := operation["apply"]
+	if !ok {
+		return nil, ErrOperationInvalid
+	}
+	list, ok := applyInterface.([]JSON)
+	if !ok {
+		return nil, ErrOperationInvalid
+	}
+	ops := make([]PredicateOp, len(list))
+	for index, item := range list {
+		obj, ok := item.(map[string]JSON)
+		if !ok {
+			return nil, ErrOperationInvalid
+		}
+		relative := make(map[string]JSON, len(obj))
+		for key, value := range obj {
+			relative[key] = value
+		}
+		if pathString, ok := obj["path"].(string); ok {
+			if err := ValidateJSONPointer(pathString); err != nil {
+				return nil, err
+			}
+			relative["path"] = path.Format() + pathString
+		}
+		op, err := createOp(relative, unit)
+		if err != nil {
+			return nil, err
+		}
+		predicate, ok := op.(PredicateOp)
+		if !ok {
+			return nil, ErrOperationInvalid
+		}
+		ops[index] = predicate
+	}
+	return ops, nil
+}
+
+func createAndOp(operation map[string]JSON, unit PositionUnit) (*OpAnd, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := getPredicates(operation, path, unit)
+	if err != nil {
+		return nil, err
+	}
+	op := OpAnd{operation: &operation, path: path, ops: ops}
+	return &op, nil
+}
+
+func createOrOp(operation map[string]JSON, unit PositionUnit) (*OpOr, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := getPredicates(operation, path, unit)
+	if err != nil {
+		return nil, err
+	}
+	op := OpOr{operation: &operation, path: path, ops: ops}
+	return &op, nil
+}
+
+func createNotOp(operation map[string]JSON, unit PositionUnit) (*OpNot, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	ops, err := getPredicates(operation, path, unit)
+	if err != nil {
+		return nil, err
+	}
+	op := OpNot{operation: &operation, path: path, ops: ops}
+	return &op, nil
+}
+
+// Code returns "defined".
+func (op *OpDefined) Code() string {
+	return "defined"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpDefined) Path() JSONPointer {
+	return op.path
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpDefined) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "defined", "path": op.path.Format()}
+}
+
+// Code returns "undefined".
+func (op *OpUndefined) Code() string {
+	return "undefined"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpUndefined) Path() JSONPointer {
+	return op.path
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpUndefined) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "undefined", "path": op.path.Format()}
+}
+
+// Code returns "type".
+func (op *OpType) Code() string {
+	return "type"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpType) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the expected type.
+func (op *OpType) Value() string {
+	return op.value
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpType) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "type", "path": op.path.Format(), "value": op.value}
+}
+
+// Code returns "test_type".
+func (op *OpTestType) Code() string {
+	return "test_type"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpTestType) Path() JSONPointer {
+	return op.path
+}
+
+// Types returns the list of accepted types.
+func (op *OpTestType) Types() []string {
+	return op.types
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpTestType) ToJSON() map[string]JSON {
+	types := make([]JSON, len(op.types))
+	for index, typ := range op.types {
+		types[index] = typ
+	}
+	return map[string]JSON{"op": "test_type", "path": op.path.Format(), "type": types}
+}
+
+// Code returns "starts".
+func (op *OpStarts) Code() string {
+	return "starts"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpStarts) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the expected prefix.
+func (op *OpStarts) Value() string {
+	return op.value
+}
+
+// IgnoreCase returns true if comparison is case insensitive.
+func (op *OpStarts) IgnoreCase() bool {
+	return op.ignoreCase
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpStarts) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "starts", "path": op.path.Format(), "value": op.value}
+	if op.ignoreCase {
+		res["ignore_case"] = true
+	}
+	return res
+}
+
+// Code returns "ends".
+func (op *OpEnds) Code() string {
+	return "ends"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpEnds) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the expected suffix.
+func (op *OpEnds) Value() string {
+	return op.value
+}
+
+// IgnoreCase returns true if comparison is case insensitive.
+func (op *OpEnds) IgnoreCase() bool {
+	return op.ignoreCase
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpEnds) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "ends", "path": op.path.Format(), "value": op.value}
+	if op.ignoreCase {
+		res["ignore_case"] = true
+	}
+	return res
+}
+
+// Code returns "contains".
+func (op *OpContains) Code() string {
+	return "contains"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpContains) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the expected substring.
+func (op *OpContains) Value() string {
+	return op.value
+}
+
+// IgnoreCase returns true if comparison is case insensitive.
+func (op *OpContains) IgnoreCase() bool {
+	return op.ignoreCase
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpContains) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "contains", "path": op.path.Format(), "value": op.value}
+	if op.ignoreCase {
+		res["ignore_case"] = true
+	}
+	return res
+}
+
+// Code returns "matches".
+func (op *OpMatches) Code() string {
+	return "matches"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpMatches) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the regular expression.
+func (op *OpMatches) Value() string {
+	return op.value
+}
+
+// IgnoreCase returns true if comparison is case insensitive.
+func (op *OpMatches) IgnoreCase() bool {
+	return op.ignoreCase
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpMatches) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "matches", "path": op.path.Format(), "value": op.value}
+	if op.ignoreCase {
+		res["ignore_case"] = true
+	}
+	return res
+}
+
+// Code returns "test_string".
+func (op *OpTestString) Code() string {
+	return "test_string"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpTestString) Path() JSONPointer {
+	return op.path
+}
+
+// Pos returns the position of the tested substring.
+func (op *OpTestString) Pos() int {
+	return op.pos
+}
+
+// Str returns the expected substring.
+func (op *OpTestString) Str() string {
+	return op.str
+}
+
+// Not returns true if the test is negated.
+func (op *OpTestString) Not() bool {
+	return op.not
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpTestString) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "test_string", "path": op.path.Format(), "pos": float64(op.pos), "str": op.str}
+	if op.not {
+		res["not"] = true
+	}
+	return res
+}
+
+// Code returns "test_string_len".
+func (op *OpTestStringLen) Code() string {
+	return "test_string_len"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpTestStringLen) Path() JSONPointer {
+	return op.path
+}
+
+// Len returns the minimum string length.
+func (op *OpTestStringLen) Len() int {
+	return op.len
+}
+
+// Not returns true if the test is negated.
+func (op *OpTestStringLen) Not() bool {
+	return op.not
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpTestStringLen) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "test_string_len", "path": op.path.Format(), "len": float64(op.len)}
+	if op.not {
+		res["not"] = true
+	}
+	return res
+}
+
+// Code returns "less".
+func (op *OpLess) Code() string {
+	return "less"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpLess) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the upper bound.
+func (op *OpLess) Value() float64 {
+	return op.value
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpLess) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "less", "path": op.path.Format(), "value": op.value}
+}
+
+// Code returns "more".
+func (op *OpMore) Code() string {
+	return "more"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpMore) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the lower bound.
+func (op *OpMore) Value() float64 {
+	return op.value
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpMore) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "more", "path": op.path.Format(), "value": op.value}
+}
+
+// Code returns "in".
+func (op *OpIn) Code() string {
+	return "in"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpIn) Path() JSONPointer {
+	return op.path
+}
+
+// Value returns the list of accepted values.
+func (op *OpIn) Value() []JSON {
+	return op.value
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpIn) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "in", "path": op.path.Format(), "value": op.value}
+}
+
+// Code returns "and".
+func (op *OpAnd) Code() string {
+	return "and"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpAnd) Path() JSONPointer {
+	return op.path
+}
+
+// Ops returns the nested predicates, their paths are absolute.
+func (op *OpAnd) Ops() []PredicateOp {
+	return op.ops
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpAnd) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "and", "path": op.path.Format(), "apply": predicatesToJSON(op.path, op.ops)}
+}
+
+// Code returns "or".
+func (op *OpOr) Code() string {
+	return "or"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpOr) Path() JSONPointer {
+	return op.path
+}
+
+// Ops returns the nested predicates, their paths are absolute.
+func (op *OpOr) Ops() []PredicateOp {
+	return op.ops
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpOr) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "or", "path": op.path.Format(), "apply": predicatesToJSON(op.path, op.ops)}
+}
+
+// Code returns "not".
+func (op *OpNot) Code() string {
+	return "not"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpNot) Path() JSONPointer {
+	return op.path
+}
+
+// Ops returns the nested predicates, their paths are absolute.
+func (op *OpNot) Ops() []PredicateOp {
+	return op.ops
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpNot) ToJSON() map[string]JSON {
+	return map[string]JSON{"op": "not", "path": op.path.Format(), "apply": predicatesToJSON(op.path, op.ops)}
+}
+
+// predicatesToJSON formats nested predicates with paths relative to path.
+func predicatesToJSON(path JSONPointer, ops []PredicateOp) []JSON {
+	list := make([]JSON, len(ops))
+	for index, op := range ops {
+		obj := op.ToJSON()
+		obj["path"] = op.Path()[len(path):].Format()
+		list[index] = obj
+	}
+	return list
+}
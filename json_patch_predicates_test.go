@@ -0,0 +1,374 @@
+package jsonjoy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func applyPredicatePatch(t *testing.T, document, patch string) error {
+	var doc interface{}
+	var p interface{}
+	json.Unmarshal([]byte(document), &doc)
+	json.Unmarshal([]byte(patch), &p)
+	ops, index, err := CreateOps(p)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, index)
+	return unwrapPatchError(ApplyOps(&doc, ops))
+}
+
+// unwrapPatchError returns the sentinel error wrapped by *PatchError.
+func unwrapPatchError(err error) error {
+	if patchErr, ok := err.(*PatchError); ok {
+		return patchErr.Err
+	}
+	return err
+}
+
+func Test_JsonPatchPredicates_Defined_PassesWhenValueExists(t *testing.T) {
+	err := applyPredicatePatch(t, `{"a": [null]}`, `[
+		{"op": "defined", "path": "/a"},
+		{"op": "defined", "path": "/a/0"}
+	]`)
+	assert.Nil(t, err)
+}
+
+func Test_JsonPatchPredicates_Defined_FailsWhenValueIsMissing(t *testing.T) {
+	err := applyPredicatePatch(t, `{"a": []}`, `[{"op": "defined", "path": "/a/0"}]`)
+	assert.True(t, errors.Is(err, ErrPredicate))
+	err = applyPredicatePatch(t, `{"a": []}`, `[{"op": "defined", "path": "/b/c"}]`)
+	assert.True(t, errors.Is(err, ErrPredicate))
+}
+
+func Test_JsonPatchPredicates_Undefined_PassesWhenValueIsMissing(t *testing.T) {
+	err := applyPredicatePatch(t, `{"a": 1}`, `[
+		{"op": "undefined", "path": "/b"},
+		{"op": "undefined", "path": "/a/b"}
+	]`)
+	assert.Nil(t, err)
+}
+
+func Test_JsonPatchPredicates_Undefined_FailsWhenValueExists(t *testing.T) {
+	err := applyPredicatePatch(t, `{"a": 1}`, `[{"op": "undefined", "path": "/a"}]`)
+	assert.True(t, errors.Is(err, ErrPredicate))
+}
+
+func Test_JsonPatchPredicates_Type_ChecksAllTypes(t *testing.T) {
+	doc := `{"n": null, "i": 1, "f": 1.5, "s": "", "b": false, "a": [], "o": {}}`
+	passing := [][2]string{
+		{"/n", "null"},
+		{"/i", "integer"},
+		{"/i", "number"},
+		{"/f", "number"},
+		{"/s", "string"},
+		{"/b", "boolean"},
+		{"/a", "array"},
+		{"/o", "object"},
+	}
+	for _, pair := range passing {
+		patch := `[{"op": "type", "path": "` + pair[0] + `", "value": "` + pair[1] + `"}]`
+		assert.Nil(t, applyPredicatePatch(t, doc, patch), pair[0]+" "+pair[1])
+	}
+	failing := [][2]string{
+		{"/n", "object"},
+		{"/f", "integer"},
+		{"/s", "number"},
+		{"/b", "string"},
+		{"/a", "object"},
+		{"/o", "array"},
+	}
+	for _, pair := range failing {
+		patch := `[{"op": "type", "path": "` + pair[0] + `", "value": "` + pair[1] + `"}]`
+		assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, patch), pair[0]+" "+pair[1])
+	}
+}
+
+func Test_JsonPatchPredicates_Type_ReturnsErrorWhenPathIsMissing(t *testing.T) {
+	err := applyPredicatePatch(t, `{}`, `[{"op": "type", "path": "/a", "value": "null"}]`)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func Test_JsonPatchPredicates_TestType_PassesWhenAnyTypeMatches(t *testing.T) {
+	err := applyPredicatePatch(t, `{"a": "x"}`, `[{"op": "test_type", "path": "/a", "type": ["number", "string"]}]`)
+	assert.Nil(t, err)
+	err = applyPredicatePatch(t, `{"a": true}`, `[{"op": "test_type", "path": "/a", "type": ["number", "string"]}]`)
+	assert.True(t, errors.Is(err, ErrPredicate))
+}
+
+func Test_JsonPatchPredicates_CreateOps_ValidatesPredicateOperations(t *testing.T) {
+	invalid := []string{
+		`[{"op": "defined"}]`,
+		`[{"op": "undefined", "path": 1}]`,
+		`[{"op": "type", "path": "/a"}]`,
+		`[{"op": "type", "path": "/a", "value": "float"}]`,
+		`[{"op": "test_type", "path": "/a"}]`,
+		`[{"op": "test_type", "path": "/a", "type": []}]`,
+		`[{"op": "test_type", "path": "/a", "type": ["string", 1]}]`,
+	}
+	for _, patch := range invalid {
+		var p interface{}
+		json.Unmarshal([]byte(patch), &p)
+		_, index, err := CreateOps(p)
+		assert.Equal(t, 0, index, patch)
+		assert.NotNil(t, err, patch)
+	}
+}
+
+func Test_JsonPatchPredicates_ApplyOps_StopsAtFailingPredicate(t *testing.T) {
+	var doc interface{}
+	var p interface{}
+	json.Unmarshal([]byte(`{"a": 1}`), &doc)
+	json.Unmarshal([]byte(`[
+		{"op": "type", "path": "/a", "value": "string"},
+		{"op": "replace", "path": "/a", "value": 2}
+	]`), &p)
+	ops, _, _ := CreateOps(p)
+	err := ApplyOps(&doc, ops)
+	assert.True(t, errors.Is(err, ErrPredicate))
+	assert.Equal(t, map[string]JSON{"a": 1.0}, doc)
+}
+
+func Test_JsonPatchPredicates_Starts_ChecksPrefix(t *testing.T) {
+	doc := `{"a": "Hello world"}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "starts", "path": "/a", "value": "Hello"}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "starts", "path": "/a", "value": "hello"}]`))
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "starts", "path": "/a", "value": "hello", "ignore_case": true}]`))
+}
+
+func Test_JsonPatchPredicates_Ends_ChecksSuffix(t *testing.T) {
+	doc := `{"a": "Hello world"}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "ends", "path": "/a", "value": "world"}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "ends", "path": "/a", "value": "WORLD"}]`))
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "ends", "path": "/a", "value": "WORLD", "ignore_case": true}]`))
+}
+
+func Test_JsonPatchPredicates_Contains_ChecksSubstring(t *testing.T) {
+	doc := `{"a": "Hello world"}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "contains", "path": "/a", "value": "o w"}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "contains", "path": "/a", "value": "O W"}]`))
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "contains", "path": "/a", "value": "O W", "ignore_case": true}]`))
+}
+
+func Test_JsonPatchPredicates_Matches_ChecksRegularExpression(t *testing.T) {
+	doc := `{"a": "Hello world"}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "matches", "path": "/a", "value": "^H.+d$"}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "matches", "path": "/a", "value": "^h"}]`))
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "matches", "path": "/a", "value": "^h", "ignore_case": true}]`))
+}
+
+func Test_JsonPatchPredicates_StringPredicatesFailOnNonStrings(t *testing.T) {
+	doc := `{"a": 123}`
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "starts", "path": "/a", "value": "1"}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "matches", "path": "/a", "value": ".*"}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "test_string_len", "path": "/a", "len": 0}]`))
+}
+
+func Test_JsonPatchPredicates_TestString_ChecksSubstringAtPosition(t *testing.T) {
+	doc := `{"a": "Hello world"}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "test_string", "path": "/a", "pos": 6, "str": "world"}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "test_string", "path": "/a", "pos": 5, "str": "world"}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "test_string", "path": "/a", "pos": 8, "str": "rld!"}]`))
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "test_string", "path": "/a", "pos": 5, "str": "world", "not": true}]`))
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "test_string", "path": "/a", "pos": 100, "str": ""}]`))
+}
+
+func Test_JsonPatchPredicates_TestStringLen_ChecksMinimumLength(t *testing.T) {
+	doc := `{"a": "Hello"}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "test_string_len", "path": "/a", "len": 5}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "test_string_len", "path": "/a", "len": 6}]`))
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "test_string_len", "path": "/a", "len": 6, "not": true}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "test_string_len", "path": "/a", "len": 5, "not": true}]`))
+}
+
+func Test_JsonPatchPredicates_CreateOps_ValidatesStringPredicateOperations(t *testing.T) {
+	invalid := []string{
+		`[{"op": "starts", "path": "/a"}]`,
+		`[{"op": "ends", "path": "/a", "value": 1}]`,
+		`[{"op": "contains", "path": "/a", "value": "a", "ignore_case": 1}]`,
+		`[{"op": "matches", "path": "/a", "value": "("}]`,
+		`[{"op": "test_string", "path": "/a", "str": "a"}]`,
+		`[{"op": "test_string", "path": "/a", "pos": -1, "str": "a"}]`,
+		`[{"op": "test_string", "path": "/a", "pos": 1}]`,
+		`[{"op": "test_string_len", "path": "/a"}]`,
+		`[{"op": "test_string_len", "path": "/a", "len": 1, "not": "no"}]`,
+	}
+	for _, patch := range invalid {
+		var p interface{}
+		json.Unmarshal([]byte(patch), &p)
+		_, index, err := CreateOps(p)
+		assert.Equal(t, 0, index, patch)
+		assert.NotNil(t, err, patch)
+	}
+}
+
+func Test_JsonPatchPredicates_GuardsStringEdits(t *testing.T) {
+	var doc interface{}
+	var p interface{}
+	json.Unmarshal([]byte(`{"text": "Hello world"}`), &doc)
+	json.Unmarshal([]byte(`[
+		{"op": "test_string", "path": "/text", "pos": 6, "str": "world"},
+		{"op": "str_del", "path": "/text", "pos": 6, "len": 5},
+		{"op": "str_ins", "path": "/text", "pos": 6, "str": "there"}
+	]`), &p)
+	ops, _, _ := CreateOps(p)
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, map[string]JSON{"text": "Hello there"}, doc)
+	assert.True(t, errors.Is(ApplyOps(&doc, ops), ErrPredicate))
+}
+
+func Test_JsonPatchPredicates_Less_ComparesNumbers(t *testing.T) {
+	doc := `{"a": 5, "b": "4"}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "less", "path": "/a", "value": 6}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "less", "path": "/a", "value": 5}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "less", "path": "/b", "value": 6}]`))
+}
+
+func Test_JsonPatchPredicates_More_ComparesNumbers(t *testing.T) {
+	doc := `{"a": 5, "b": "6"}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "more", "path": "/a", "value": 4.5}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "more", "path": "/a", "value": 5}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "more", "path": "/b", "value": 4}]`))
+}
+
+func Test_JsonPatchPredicates_In_ChecksMembership(t *testing.T) {
+	doc := `{"a": {"b": [1]}}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "in", "path": "/a", "value": [1, "x", {"b": [1]}]}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "in", "path": "/a", "value": [{"b": [2]}]}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "in", "path": "/a", "value": []}]`))
+}
+
+func Test_JsonPatchPredicates_CreateOps_ValidatesNumericAndSetPredicateOperations(t *testing.T) {
+	invalid := []string{
+		`[{"op": "less", "path": "/a"}]`,
+		`[{"op": "less", "path": "/a", "value": "1"}]`,
+		`[{"op": "more", "path": "/a", "value": null}]`,
+		`[{"op": "in", "path": "/a"}]`,
+		`[{"op": "in", "path": "/a", "value": 1}]`,
+	}
+	for _, patch := range invalid {
+		var p interface{}
+		json.Unmarshal([]byte(patch), &p)
+		_, index, err := CreateOps(p)
+		assert.Equal(t, 0, index, patch)
+		assert.NotNil(t, err, patch)
+	}
+}
+
+func Test_JsonPatchPredicates_More_GuardsDecrement(t *testing.T) {
+	var doc interface{}
+	var p interface{}
+	json.Unmarshal([]byte(`{"stock": 3}`), &doc)
+	json.Unmarshal([]byte(`[
+		{"op": "more", "path": "/stock", "value": 0},
+		{"op": "inc", "path": "/stock", "inc": -1}
+	]`), &p)
+	ops, _, _ := CreateOps(p)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, ApplyOps(&doc, ops))
+	}
+	assert.True(t, errors.Is(ApplyOps(&doc, ops), ErrPredicate))
+	assert.Equal(t, map[string]JSON{"stock": 0.0}, doc)
+}
+
+func Test_JsonPatchPredicates_And_PassesWhenAllPredicatesPass(t *testing.T) {
+	doc := `{"user": {"name": "Ann", "age": 30}}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "and", "path": "/user", "apply": [
+		{"op": "starts", "path": "/name", "value": "A"},
+		{"op": "more", "path": "/age", "value": 18}
+	]}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "and", "path": "/user", "apply": [
+		{"op": "starts", "path": "/name", "value": "A"},
+		{"op": "more", "path": "/age", "value": 40}
+	]}]`))
+}
+
+func Test_JsonPatchPredicates_Or_PassesWhenAnyPredicatePasses(t *testing.T) {
+	doc := `{"user": {"name": "Ann", "age": 30}}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "or", "path": "/user", "apply": [
+		{"op": "starts", "path": "/name", "value": "B"},
+		{"op": "test", "path": "/age", "value": 30}
+	]}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "or", "path": "/user", "apply": [
+		{"op": "starts", "path": "/name", "value": "B"},
+		{"op": "undefined", "path": "/age"}
+	]}]`))
+}
+
+func Test_JsonPatchPredicates_Not_PassesWhenNoPredicatePasses(t *testing.T) {
+	doc := `{"user": {"name": "Ann", "age": 30}}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "not", "path": "/user", "apply": [
+		{"op": "defined", "path": "/email"},
+		{"op": "less", "path": "/age", "value": 18}
+	]}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "not", "path": "/user", "apply": [
+		{"op": "defined", "path": "/email"},
+		{"op": "defined", "path": "/name"}
+	]}]`))
+}
+
+func Test_JsonPatchPredicates_CompositePredicates_TreatMissingPathsAsFalse(t *testing.T) {
+	doc := `{"a": 1, "list": [1]}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "or", "path": "", "apply": [
+		{"op": "type", "path": "/b", "value": "string"},
+		{"op": "defined", "path": "/a"}
+	]}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "or", "path": "", "apply": [
+		{"op": "test", "path": "/list/5", "value": 1},
+		{"op": "starts", "path": "/b/c", "value": "x"}
+	]}]`))
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "not", "path": "", "apply": [
+		{"op": "type", "path": "/b", "value": "string"},
+		{"op": "test", "path": "/list/x", "value": 1}
+	]}]`))
+	assert.Equal(t, ErrPredicate, applyPredicatePatch(t, doc, `[{"op": "and", "path": "", "apply": [
+		{"op": "defined", "path": "/a"},
+		{"op": "less", "path": "/b", "value": 2}
+	]}]`))
+}
+
+func Test_JsonPatchPredicates_CompositePredicatesCanBeNested(t *testing.T) {
+	doc := `{"a": {"b": {"c": 1}}}`
+	assert.Nil(t, applyPredicatePatch(t, doc, `[{"op": "and", "path": "/a", "apply": [
+		{"op": "not", "path": "/b", "apply": [
+			{"op": "test", "path": "/c", "value": 2}
+		]},
+		{"op": "or", "path": "", "apply": [
+			{"op": "type", "path": "/b/c", "value": "integer"}
+		]}
+	]}]`))
+}
+
+func Test_JsonPatchPredicates_CreateOps_ResolvesNestedPathsRelativeToParent(t *testing.T) {
+	var p interface{}
+	json.Unmarshal([]byte(`[{"op": "and", "path": "/a/b", "apply": [
+		{"op": "defined", "path": "/c"},
+		{"op": "or", "path": "/d", "apply": [{"op": "defined", "path": "/e"}]}
+	]}]`), &p)
+	ops, _, err := CreateOps(p)
+	assert.Nil(t, err)
+	and := ops[0].(*OpAnd)
+	assert.Equal(t, JSONPointer{"a", "b", "c"}, and.ops[0].(*OpDefined).path)
+	or := and.ops[1].(*OpOr)
+	assert.Equal(t, JSONPointer{"a", "b", "d"}, or.path)
+	assert.Equal(t, JSONPointer{"a", "b", "d", "e"}, or.ops[0].(*OpDefined).path)
+}
+
+func Test_JsonPatchPredicates_CreateOps_AllowsOnlyPredicatesInComposites(t *testing.T) {
+	invalid := []string{
+		`[{"op": "and", "path": "/a"}]`,
+		`[{"op": "and", "path": "/a", "apply": {}}]`,
+		`[{"op": "or", "path": "/a", "apply": [1]}]`,
+		`[{"op": "or", "path": "/a", "apply": [{"op": "add", "path": "/b", "value": 1}]}]`,
+		`[{"op": "not", "path": "/a", "apply": [{"op": "defined", "path": "b"}]}]`,
+		`[{"op": "not", "path": "/a", "apply": [{"op": "and", "path": "", "apply": [{"op": "flip", "path": ""}]}]}]`,
+	}
+	for _, patch := range invalid {
+		var p interface{}
+		json.Unmarshal([]byte(patch), &p)
+		_, index, err := CreateOps(p)
+		assert.Equal(t, 0, index, patch)
+		assert.NotNil(t, err, patch)
+	}
+}
@@ -0,0 +1,34 @@
+package jsonjoy
+
+import (
+	"errors"
+)
+
+// ErrRebaseConflict is returned by Rebase when an operation of the patch
+// loses its target or a value it writes, for example a value it modifies was
+// removed or a value it replaces was replaced.
+var ErrRebaseConflict = errors.New("REBASE_CONFLICT")
+
+// Rebase transforms patch, created against some revision of a document, so
+// that it can be applied after history, the list of patches applied to that
+// revision since. Operations which become redundant, such as removing a value
+// which was already removed, are dropped silently. If an operation which
+// writes or modifies a value is discarded, because history removed or wrote
+// its target, a *PatchError wrapping ErrRebaseConflict is returned with
+// index of that operation in patch.
+func Rebase(patch []Op, history [][]Op) ([]Op, error) {
+	applied := []Op{}
+	for _, ops := range history {
+		applied = append(applied, ops...)
+	}
+	res := []Op{}
+	for index, op := range patch {
+		ops, rest, conflicts := transformPatch([]Op{op}, applied, false)
+		if conflicts > 0 {
+			return nil, &PatchError{Index: index, Op: op.Code(), Depth: -1, Err: ErrRebaseConflict}
+		}
+		res = append(res, ops...)
+		applied = rest
+	}
+	return res, nil
+}
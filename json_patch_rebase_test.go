@@ -0,0 +1,108 @@
+package jsonjoy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rebaseOps(patch string) []Op {
+	ops, _, err := CreateOps(parseJSON(patch))
+	if err != nil {
+		panic(err)
+	}
+	return ops
+}
+
+func Test_JsonPatchRebase_Rebase_TransformsOverHistory(t *testing.T) {
+	doc := parseJSON(`{"list": [1, 2, 3], "a": 1}`)
+	history := [][]Op{
+		rebaseOps(`[{"op": "add", "path": "/list/0", "value": 0}]`),
+		rebaseOps(`[{"op": "remove", "path": "/list/2"}, {"op": "add", "path": "/b", "value": 2}]`),
+	}
+	patch := rebaseOps(`[
+		{"op": "replace", "path": "/list/2", "value": 30},
+		{"op": "add", "path": "/list/1", "value": 10}
+	]`)
+	rebased, err := Rebase(patch, history)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[
+		{"op": "replace", "path": "/list/2", "value": 30},
+		{"op": "add", "path": "/list/2", "value": 10}
+	]`), JSON(PatchToJSON(rebased)))
+	for _, ops := range history {
+		assert.Nil(t, ApplyOps(&doc, ops))
+	}
+	assert.Nil(t, ApplyOps(&doc, rebased))
+	assert.Equal(t, parseJSON(`{"list": [0, 1, 10, 30], "a": 1, "b": 2}`), doc)
+}
+
+func Test_JsonPatchRebase_Rebase_ReportsConcurrentWrite(t *testing.T) {
+	history := [][]Op{rebaseOps(`[{"op": "replace", "path": "/a", "value": 2}]`)}
+	rebased, err := Rebase(rebaseOps(`[{"op": "replace", "path": "/a", "value": 3}]`), history)
+	assert.Nil(t, rebased)
+	assert.True(t, errors.Is(err, ErrRebaseConflict))
+	assert.Equal(t, 0, err.(*PatchError).Index)
+}
+
+func Test_JsonPatchRebase_Rebase_ReportsDiscardedWrites(t *testing.T) {
+	cases := []struct {
+		history string
+		patch   string
+	}{
+		{`[{"op": "remove", "path": "/a"}]`, `[{"op": "replace", "path": "/a", "value": 1}]`},
+		{`[{"op": "remove", "path": "/list/1"}]`, `[{"op": "replace", "path": "/list/1", "value": 1}]`},
+		{`[{"op": "replace", "path": "/a", "value": 2}]`, `[{"op": "inc", "path": "/a", "inc": 1}]`},
+		{`[{"op": "replace", "path": "/a", "value": 2}]`, `[{"op": "add", "path": "/a", "value": 3}]`},
+		{`[{"op": "replace", "path": "/a", "value": 2}]`, `[{"op": "move", "from": "/b", "path": "/a"}]`},
+		{`[{"op": "move", "from": "/b", "path": "/c"}]`, `[{"op": "move", "from": "/b", "path": "/d"}]`},
+		{`[{"op": "add", "path": "/o/a", "value": 2}]`, `[{"op": "extend", "path": "/o", "props": {"a": 1, "b": 1}}]`},
+	}
+	for _, c := range cases {
+		_, err := Rebase(rebaseOps(c.patch), [][]Op{rebaseOps(c.history)})
+		assert.True(t, errors.Is(err, ErrRebaseConflict), c.patch)
+	}
+}
+
+func Test_JsonPatchRebase_Rebase_SameMoveIsRedundant(t *testing.T) {
+	history := [][]Op{rebaseOps(`[{"op": "move", "from": "/b", "path": "/c"}]`)}
+	rebased, err := Rebase(rebaseOps(`[{"op": "move", "from": "/b", "path": "/c"}]`), history)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rebased))
+}
+
+func Test_JsonPatchRebase_Rebase_DropsRedundantOperations(t *testing.T) {
+	history := [][]Op{rebaseOps(`[{"op": "remove", "path": "/a"}]`)}
+	rebased, err := Rebase(rebaseOps(`[
+		{"op": "remove", "path": "/a"},
+		{"op": "add", "path": "/b", "value": 1}
+	]`), history)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[
+		{"op": "add", "path": "/b", "value": 1}
+	]`), JSON(PatchToJSON(rebased)))
+}
+
+func Test_JsonPatchRebase_Rebase_ReportsConflict(t *testing.T) {
+	history := [][]Op{
+		rebaseOps(`[{"op": "add", "path": "/c", "value": 1}]`),
+		rebaseOps(`[{"op": "remove", "path": "/a"}]`),
+	}
+	_, err := Rebase(rebaseOps(`[
+		{"op": "add", "path": "/b", "value": 1},
+		{"op": "inc", "path": "/a/x", "inc": 1}
+	]`), history)
+	assert.True(t, errors.Is(err, ErrRebaseConflict))
+	patchErr := err.(*PatchError)
+	assert.Equal(t, 1, patchErr.Index)
+	assert.Equal(t, "inc", patchErr.Op)
+	assert.Equal(t, "REBASE_CONFLICT: operation 1 (inc)", err.Error())
+}
+
+func Test_JsonPatchRebase_Rebase_EmptyHistory(t *testing.T) {
+	patch := rebaseOps(`[{"op": "add", "path": "/a", "value": 1}]`)
+	rebased, err := Rebase(patch, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, PatchToJSON(patch), PatchToJSON(rebased))
+}
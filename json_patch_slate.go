@@ -0,0 +1,409 @@
+package jsonjoy
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ErrInvalidTarget is returned when value located by JSON Pointer cannot be
+// modified by the operation.
+var ErrInvalidTarget = errors.New("INVALID_TARGET")
+
+// OpSplit JSON Patch+ "split" operation.
+type OpSplit struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	pos       int
+	props     map[string]JSON
+	unit      PositionUnit
+}
+
+// OpMerge JSON Patch+ "merge" operation. Position and props describe the
+// node which is merged and are kept so that the operation can be inverted.
+type OpMerge struct {
+	operation *map[string]JSON
+	path      JSONPointer
+	pos       int
+	props     map[string]JSON
+}
+
+// OpExtend JSON Patch+ "extend" operation.
+type OpExtend struct {
+	operation  *map[string]JSON
+	path       JSONPointer
+	props      map[string]JSON
+	deleteNull bool
+}
+
+// extendObject returns a shallow copy of obj with props copied into it.
+func extendObject(obj map[string]JSON, props map[string]JSON) map[string]JSON {
+	res := make(map[string]JSON, len(obj)+len(props))
+	for key, value := range obj {
+		res[key] = value
+	}
+	for key, value := range props {
+		res[key] = Copy(value)
+	}
+	return res
+}
+
+func clampPos(pos int, length int) int {
+	if pos > length {
+		return length
+	}
+	return pos
+}
+
+// isTextNode checks if value is a Slate.js text node, an object with "text"
+// string property.
+func isTextNode(value JSON) (map[string]JSON, string, bool) {
+	obj, ok := value.(map[string]JSON)
+	if !ok {
+		return nil, "", false
+	}
+	text, ok := obj["text"].(string)
+	return obj, text, ok
+}
+
+// isElementNode checks if value is a Slate.js element node, an object with
+// "children" array property.
+func isElementNode(value JSON) (map[string]JSON, []JSON, bool) {
+	obj, ok := value.(map[string]JSON)
+	if !ok {
+		return nil, nil, false
+	}
+	children, ok := obj["children"].([]JSON)
+	return obj, children, ok
+}
+
+// splitValue splits a value into two at position pos, positions in strings
+// are measured in unit.
+func splitValue(value JSON, pos int, props map[string]JSON, unit PositionUnit) (JSON, JSON) {
+	switch val := value.(type) {
+	case string:
+		offset := stringOffset(val, pos, unit)
+		before, after := val[:offset], val[offset:]
+		if props == nil {
+			return before, after
+		}
+		return extendObject(props, map[string]JSON{"text": before}),
+			extendObject(props, map[string]JSON{"text": after})
+	case float64:
+		return float64(pos), val - float64(pos)
+	case []JSON:
+		pos = clampPos(pos, len(val))
+		before := make([]JSON, pos)
+		copy(before, val[:pos])
+		after := make([]JSON, len(val)-pos)
+		copy(after, val[pos:])
+		return before, after
+	case map[string]JSON:
+		if _, text, ok := isTextNode(val); ok {
+			offset := stringOffset(text, pos, unit)
+			clone := extendObject(Copy(val).(map[string]JSON), props)
+			return extendObject(val, map[string]JSON{"text": text[:offset]}),
+				extendObject(clone, map[string]JSON{"text": text[offset:]})
+		}
+		if _, children, ok := isElementNode(val); ok {
+			before, after := splitValue(children, pos, nil, unit)
+			clone := extendObject(Copy(val).(map[string]JSON), props)
+			return extendObject(val, map[string]JSON{"children": before}),
+				extendObject(clone, map[string]JSON{"children": after})
+		}
+	}
+	return value, Copy(value)
+}
+
+// mergeValues merges two adjacent values into one.
+func mergeValues(one JSON, two JSON) JSON {
+	switch a := one.(type) {
+	case string:
+		if b, ok := two.(string); ok {
+			return a + b
+		}
+	case float64:
+		if b, ok := two.(float64); ok {
+			return a + b
+		}
+	case []JSON:
+		if b, ok := two.([]JSON); ok {
+			res := make([]JSON, 0, len(a)+len(b))
+			res = append(res, a...)
+			return append(res, b...)
+		}
+	case map[string]JSON:
+		if _, text1, ok := isTextNode(a); ok {
+			if _, text2, ok := isTextNode(two); ok {
+				return extendObject(a, map[string]JSON{"text": text1 + text2})
+			}
+		}
+		if _, children1, ok := isElementNode(a); ok {
+			if _, children2, ok := isElementNode(two); ok {
+				children := mergeValues(children1, children2)
+				return extendObject(a, map[string]JSON{"children": children})
+			}
+		}
+	}
+	return []JSON{one, two}
+}
+
+// JSONPatchSplit executes JSON Patch+ "split" operation. A string, number,
+// array or Slate.js node is split in two at position pos, when the value is
+// an array element both halves are stored as siblings, otherwise the value
+// is replaced by a two element array. When props are set, they are merged
+// into the second half. Positions in strings are measured in UTF-16 code
+// units.
+func JSONPatchSplit(doc *JSON, tokens JSONPointer, pos int, props map[string]JSON) error {
+	return jsonPatchSplit(doc, tokens, pos, props, PositionUTF16)
+}
+
+func jsonPatchSplit(doc *JSON, tokens JSONPointer, pos int, props map[string]JSON, unit PositionUnit) error {
+	value, err := tokens.Get(*doc)
+	if err != nil {
+		return err
+	}
+	before, after := splitValue(value, pos, props, unit)
+	if !tokens.IsRoot() {
+		parent, err := tokens[:len(tokens)-1].Get(*doc)
+		if err != nil {
+			return err
+		}
+		if _, ok := parent.([]JSON); ok {
+			key := tokens[len(tokens)-1]
+			index, err := ParseTokenAsArrayIndex(key, -1)
+			if err != nil {
+				return err
+			}
+			next := make(JSONPointer, len(tokens))
+			copy(next, tokens)
+			next[len(next)-1] = strconv.Itoa(index + 1)
+			if err := Replace(doc, tokens, before); err != nil {
+				return err
+			}
+			return Add(doc, next, after)
+		}
+	}
+	return Replace(doc, tokens, []JSON{before, after})
+}
+
+// JSONPatchMerge executes JSON Patch+ "merge" operation. The array element
+// located by tokens is merged into its previous sibling.
+func JSONPatchMerge(doc *JSON, tokens JSONPointer) error {
+	if tokens.IsRoot() {
+		return ErrInvalidTarget
+	}
+	parentTokens := tokens[:len(tokens)-1]
+	parent, err := parentTokens.Get(*doc)
+	if err != nil {
+		return err
+	}
+	arr, ok := parent.([]JSON)
+	if !ok {
+		return ErrInvalidTarget
+	}
+	index, err := parseElementIndex(tokens[len(tokens)-1], len(arr))
+	if err != nil {
+		return err
+	}
+	if index < 1 {
+		return ErrInvalidIndex
+	}
+	merged := mergeValues(arr[index-1], arr[index])
+	prev := make(JSONPointer, len(tokens))
+	copy(prev, tokens)
+	prev[len(prev)-1] = strconv.Itoa(index - 1)
+	if err := Replace(doc, prev, merged); err != nil {
+		return err
+	}
+	_, err = Remove(doc, tokens)
+	return err
+}
+
+// JSONPatchExtend executes JSON Patch+ "extend" operation, props are
+// shallow-merged into the object located by tokens. When deleteNull is set,
+// keys which have null value in props are deleted from the object.
+func JSONPatchExtend(doc *JSON, tokens JSONPointer, props map[string]JSON, deleteNull bool) error {
+	value, err := tokens.Get(*doc)
+	if err != nil {
+		return err
+	}
+	obj, ok := value.(map[string]JSON)
+	if !ok {
+		return ErrInvalidTarget
+	}
+	for key, val := range props {
+		if deleteNull && val == nil {
+			delete(obj, key)
+			continue
+		}
+		obj[key] = Copy(val)
+	}
+	return nil
+}
+
+func (op *OpSplit) Apply(doc *JSON) error {
+	return jsonPatchSplit(doc, op.path, op.pos, op.props, op.unit)
+}
+
+func (op *OpMerge) Apply(doc *JSON) error {
+	return JSONPatchMerge(doc, op.path)
+}
+
+func (op *OpExtend) Apply(doc *JSON) error {
+	return JSONPatchExtend(doc, op.path, op.props, op.deleteNull)
+}
+
+// Code returns "split".
+func (op *OpSplit) Code() string {
+	return "split"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpSplit) Path() JSONPointer {
+	return op.path
+}
+
+// Pos returns the split position.
+func (op *OpSplit) Pos() int {
+	return op.pos
+}
+
+// Props returns properties of the second half, or nil.
+func (op *OpSplit) Props() map[string]JSON {
+	return op.props
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpSplit) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "split", "path": op.path.Format(), "pos": float64(op.pos)}
+	if op.props != nil {
+		res["props"] = op.props
+	}
+	return res
+}
+
+// Code returns "merge".
+func (op *OpMerge) Code() string {
+	return "merge"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpMerge) Path() JSONPointer {
+	return op.path
+}
+
+// Pos returns the position at which values were merged.
+func (op *OpMerge) Pos() int {
+	return op.pos
+}
+
+// Props returns properties of the merged node, or nil.
+func (op *OpMerge) Props() map[string]JSON {
+	return op.props
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpMerge) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "merge", "path": op.path.Format(), "pos": float64(op.pos)}
+	if op.props != nil {
+		res["props"] = op.props
+	}
+	return res
+}
+
+// Code returns "extend".
+func (op *OpExtend) Code() string {
+	return "extend"
+}
+
+// Path returns the "path" of the operation.
+func (op *OpExtend) Path() JSONPointer {
+	return op.path
+}
+
+// Props returns the properties which are merged into the object.
+func (op *OpExtend) Props() map[string]JSON {
+	return op.props
+}
+
+// DeleteNull returns true if null properties are deleted.
+func (op *OpExtend) DeleteNull() bool {
+	return op.deleteNull
+}
+
+// ToJSON returns canonical JSON form of the operation.
+func (op *OpExtend) ToJSON() map[string]JSON {
+	res := map[string]JSON{"op": "extend", "path": op.path.Format(), "props": op.props}
+	if op.deleteNull {
+		res["deleteNull"] = true
+	}
+	return res
+}
+
+// getProps reads "props" object field of an operation, returns nil if the
+// field is not set and is not required.
+func getProps(operation map[string]JSON, required bool) (map[string]JSON, error) {
+	propsInterface, ok := operation["props"]
+	if !ok || propsInterface == nil {
+		if required {
+			return nil, ErrOperationInvalid
+		}
+		return nil, nil
+	}
+	props, ok := propsInterface.(map[string]JSON)
+	if !ok {
+		return nil, ErrOperationInvalid
+	}
+	return props, nil
+}
+
+func createSplitOp(operation map[string]JSON, unit PositionUnit) (*OpSplit, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := getPosition(operation, "pos")
+	if err != nil {
+		return nil, err
+	}
+	props, err := getProps(operation, false)
+	if err != nil {
+		return nil, err
+	}
+	op := OpSplit{operation: &operation, path: path, pos: pos, props: props, unit: unit}
+	return &op, nil
+}
+
+func createMergeOp(operation map[string]JSON) (*OpMerge, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := getPosition(operation, "pos")
+	if err != nil {
+		return nil, err
+	}
+	props, err := getProps(operation, false)
+	if err != nil {
+		return nil, err
+	}
+	op := OpMerge{operation: &operation, path: path, pos: pos, props: props}
+	return &op, nil
+}
+
+func createExtendOp(operation map[string]JSON) (*OpExtend, error) {
+	path, err := getPath(operation)
+	if err != nil {
+		return nil, err
+	}
+	props, err := getProps(operation, true)
+	if err != nil {
+		return nil, err
+	}
+	deleteNull, err := getFlag(operation, "deleteNull")
+	if err != nil {
+		return nil, err
+	}
+	op := OpExtend{operation: &operation, path: path, props: props, deleteNull: deleteNull}
+	return &op, nil
+}
@@ -0,0 +1,157 @@
+package jsonjoy
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func applySlatePatch(t *testing.T, document, patch string) (JSON, error) {
+	var doc interface{}
+	var p interface{}
+	json.Unmarshal([]byte(document), &doc)
+	json.Unmarshal([]byte(patch), &p)
+	ops, index, err := CreateOps(p)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, index)
+	err = ApplyOps(&doc, ops)
+	return doc, unwrapPatchError(err)
+}
+
+func parseJSON(str string) JSON {
+	var value interface{}
+	json.Unmarshal([]byte(str), &value)
+	return value
+}
+
+func Test_JsonPatchSlate_Split_SplitsStringInArray(t *testing.T) {
+	doc, err := applySlatePatch(t, `["foobar", "x"]`, `[{"op": "split", "path": "/0", "pos": 3}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`["foo", "bar", "x"]`), doc)
+}
+
+func Test_JsonPatchSlate_Split_SplitsStringInObjectIntoTuple(t *testing.T) {
+	doc, err := applySlatePatch(t, `{"a": "foobar"}`, `[{"op": "split", "path": "/a", "pos": 2}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`{"a": ["fo", "obar"]}`), doc)
+}
+
+func Test_JsonPatchSlate_Split_SplitsRootString(t *testing.T) {
+	doc, err := applySlatePatch(t, `"foobar"`, `[{"op": "split", "path": "", "pos": 10}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`["foobar", ""]`), doc)
+}
+
+func Test_JsonPatchSlate_Split_SplitsStringIntoTextNodesWithProps(t *testing.T) {
+	doc, err := applySlatePatch(t, `["foobar"]`, `[{"op": "split", "path": "/0", "pos": 3, "props": {"bold": true}}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[{"text": "foo", "bold": true}, {"text": "bar", "bold": true}]`), doc)
+}
+
+func Test_JsonPatchSlate_Split_SplitsNumbersAndArrays(t *testing.T) {
+	doc, err := applySlatePatch(t, `[10, [1, 2, 3]]`, `[
+		{"op": "split", "path": "/1", "pos": 1},
+		{"op": "split", "path": "/0", "pos": 3}
+	]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[3, 7, [1], [2, 3]]`), doc)
+}
+
+func Test_JsonPatchSlate_Split_SplitsTextNodeApplyingPropsToSecondHalf(t *testing.T) {
+	doc, err := applySlatePatch(t, `{"children": [{"text": "Hello world", "bold": true}]}`,
+		`[{"op": "split", "path": "/children/0", "pos": 5, "props": {"italic": true}}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`{"children": [
+		{"text": "Hello", "bold": true},
+		{"text": " world", "bold": true, "italic": true}
+	]}`), doc)
+}
+
+func Test_JsonPatchSlate_Split_SplitsElementNode(t *testing.T) {
+	doc, err := applySlatePatch(t, `[{"type": "p", "children": [{"text": "a"}, {"text": "b"}]}]`,
+		`[{"op": "split", "path": "/0", "pos": 1, "props": {"type": "h1"}}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[
+		{"type": "p", "children": [{"text": "a"}]},
+		{"type": "h1", "children": [{"text": "b"}]}
+	]`), doc)
+}
+
+func Test_JsonPatchSlate_Split_ReturnsErrorWhenTargetIsMissing(t *testing.T) {
+	_, err := applySlatePatch(t, `[]`, `[{"op": "split", "path": "/0", "pos": 1}]`)
+	assert.True(t, errors.Is(err, ErrInvalidIndex))
+}
+
+func Test_JsonPatchSlate_Merge_MergesAdjacentValues(t *testing.T) {
+	doc, err := applySlatePatch(t, `["foo", "bar", 1, 2, [1], [2], true]`, `[
+		{"op": "merge", "path": "/5", "pos": 1},
+		{"op": "merge", "path": "/3", "pos": 1},
+		{"op": "merge", "path": "/1", "pos": 3}
+	]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`["foobar", 3, [1, 2], true]`), doc)
+}
+
+func Test_JsonPatchSlate_Merge_MergesSlateNodes(t *testing.T) {
+	doc, err := applySlatePatch(t, `[
+		{"type": "p", "children": [{"text": "a", "bold": true}]},
+		{"type": "p", "children": [{"text": "b"}]}
+	]`, `[
+		{"op": "merge", "path": "/1", "pos": 1},
+		{"op": "merge", "path": "/0/children/1", "pos": 1}
+	]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[{"type": "p", "children": [{"text": "ab", "bold": true}]}]`), doc)
+}
+
+func Test_JsonPatchSlate_Merge_MergesIncompatibleValuesIntoTuple(t *testing.T) {
+	doc, err := applySlatePatch(t, `{"a": ["x", 1]}`, `[{"op": "merge", "path": "/a/1", "pos": 1}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`{"a": [["x", 1]]}`), doc)
+}
+
+func Test_JsonPatchSlate_Merge_ReturnsErrorOnInvalidTarget(t *testing.T) {
+	_, err := applySlatePatch(t, `{"a": "x"}`, `[{"op": "merge", "path": "/a", "pos": 1}]`)
+	assert.True(t, errors.Is(err, ErrInvalidTarget))
+	_, err = applySlatePatch(t, `["a", "b"]`, `[{"op": "merge", "path": "/0", "pos": 1}]`)
+	assert.True(t, errors.Is(err, ErrInvalidIndex))
+	_, err = applySlatePatch(t, `["a", "b"]`, `[{"op": "merge", "path": "", "pos": 1}]`)
+	assert.True(t, errors.Is(err, ErrInvalidTarget))
+}
+
+func Test_JsonPatchSlate_Extend_MergesPropsIntoObject(t *testing.T) {
+	doc, err := applySlatePatch(t, `{"a": {"x": 1, "y": 2}}`, `[{"op": "extend", "path": "/a", "props": {"y": 3, "z": null}}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`{"a": {"x": 1, "y": 3, "z": null}}`), doc)
+}
+
+func Test_JsonPatchSlate_Extend_CanDeleteNullProps(t *testing.T) {
+	doc, err := applySlatePatch(t, `{"a": {"x": 1, "y": 2}}`, `[{"op": "extend", "path": "/a", "props": {"x": null, "z": 1}, "deleteNull": true}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`{"a": {"y": 2, "z": 1}}`), doc)
+}
+
+func Test_JsonPatchSlate_Extend_ReturnsErrorWhenTargetIsNotAnObject(t *testing.T) {
+	_, err := applySlatePatch(t, `{"a": [1]}`, `[{"op": "extend", "path": "/a", "props": {"x": 1}}]`)
+	assert.True(t, errors.Is(err, ErrInvalidTarget))
+}
+
+func Test_JsonPatchSlate_CreateOps_ValidatesOperations(t *testing.T) {
+	invalid := []string{
+		`[{"op": "split", "path": "/a"}]`,
+		`[{"op": "split", "path": "/a", "pos": 1, "props": 1}]`,
+		`[{"op": "merge", "path": "/a"}]`,
+		`[{"op": "extend", "path": "/a"}]`,
+		`[{"op": "extend", "path": "/a", "props": []}]`,
+		`[{"op": "extend", "path": "/a", "props": {}, "deleteNull": 1}]`,
+	}
+	for _, patch := range invalid {
+		var p interface{}
+		json.Unmarshal([]byte(patch), &p)
+		_, index, err := CreateOps(p)
+		assert.Equal(t, 0, index, patch)
+		assert.NotNil(t, err, patch)
+	}
+}
@@ -2,6 +2,7 @@ package jsonjoy
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
@@ -47,7 +48,7 @@ var b2 = []byte(`[
     ]`)
 var doc interface{}
 var patch interface{}
-var ops []interface{}
+var ops []Op
 
 func TestMain(m *testing.M) {
 	json.Unmarshal(b1, &doc)
@@ -291,6 +292,68 @@ func Test_JsonPatch_ApplyOps_TestOperation(t *testing.T) {
 	assert.Equal(t, "bar", m["foo"])
 }
 
+func Test_JsonPatch_ApplyOps_TestOperationWithNotFlagPassesWhenValuesDiffer(t *testing.T) {
+	b1 := []byte(`{
+		"x": 2
+	}`)
+	b2 := []byte(`[
+		{"op": "test", "path": "/x", "value": 1, "not": true},
+		{"op": "replace", "path": "/x", "value": 3}
+	]`)
+	var doc interface{}
+	var patch interface{}
+	json.Unmarshal(b1, &doc)
+	json.Unmarshal(b2, &patch)
+	ops, _, _ := CreateOps(patch)
+	err := ApplyOps(&doc, ops)
+	assert.Nil(t, err)
+	assert.Equal(t, "map[x:3]", fmt.Sprint(doc))
+}
+
+func Test_JsonPatch_ApplyOps_TestOperationWithNotFlagFailsWhenValuesAreEqual(t *testing.T) {
+	b1 := []byte(`{
+		"x": {"a": [1]}
+	}`)
+	b2 := []byte(`[
+		{"op": "test", "path": "/x", "value": {"a": [1]}, "not": true}
+	]`)
+	var doc interface{}
+	var patch interface{}
+	json.Unmarshal(b1, &doc)
+	json.Unmarshal(b2, &patch)
+	ops, _, _ := CreateOps(patch)
+	err := ApplyOperation(&doc, ops[0])
+	assert.True(t, errors.Is(err, ErrTest))
+}
+
+func Test_JsonPatch_ApplyOps_TestOperationWithNotFlagPassesWhenPathIsMissing(t *testing.T) {
+	doc := parseJSON(`{"x": {"a": [1]}}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "test", "path": "/y", "value": 1, "not": true},
+		{"op": "test", "path": "/x/a/3", "value": 1, "not": true},
+		{"op": "and", "path": "", "apply": [{"op": "test", "path": "/x/b", "value": 1, "not": true}]}
+	]`))
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.True(t, errors.Is(JSONPatchTest(&doc, JSONPointer{"y"}, 1.0), ErrNotFound))
+	assert.Nil(t, JSONPatchTestNot(&doc, JSONPointer{"y"}, 1.0))
+}
+
+func Test_JsonPatch_ApplyOps_TestOperationWithNotFlagSetToFalse(t *testing.T) {
+	b1 := []byte(`{
+		"x": 1
+	}`)
+	b2 := []byte(`[
+		{"op": "test", "path": "/x", "value": 2, "not": false}
+	]`)
+	var doc interface{}
+	var patch interface{}
+	json.Unmarshal(b1, &doc)
+	json.Unmarshal(b2, &patch)
+	ops, _, _ := CreateOps(patch)
+	err := ApplyOps(&doc, ops)
+	assert.True(t, errors.Is(err, ErrTest))
+}
+
 func Test_JsonPatch_ApplyOps_NotFoundPath(t *testing.T) {
 	b1 := []byte(`{
 		"q": {"bar": 2}
@@ -304,7 +367,8 @@ func Test_JsonPatch_ApplyOps_NotFoundPath(t *testing.T) {
 	json.Unmarshal(b2, &patch)
 	ops, _, _ := CreateOps(patch)
 	err := ApplyOps(&doc, ops)
-	assert.Equal(t, "NOT_FOUND", fmt.Sprint(err))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, `NOT_FOUND: operation 0 (add), path "/a/b" at token 0`, fmt.Sprint(err))
 }
 
 func Test_JsonPatch_ApplyOps_CanInsertTextIntoTextCell(t *testing.T) {
@@ -370,3 +434,242 @@ func Benchmark_JsonPatch_ApplyOps_2(b *testing.B) {
 		ApplyOps(&doc, ops)
 	}
 }
+
+func Test_JsonPatch_ApplyOpsAtomic_AppliesAllOperations(t *testing.T) {
+	b1 := []byte(`{
+		"foo": "bar"
+	}`)
+	b2 := []byte(`[
+		{"op": "replace", "path": "/foo", "value": "baz"},
+		{"op": "add", "path": "/gg", "value": [123]}
+	]`)
+	var doc interface{}
+	var patch interface{}
+	json.Unmarshal(b1, &doc)
+	json.Unmarshal(b2, &patch)
+	ops, _, _ := CreateOps(patch)
+	index, err := ApplyOpsAtomic(&doc, ops)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, index)
+	assert.Equal(t, "map[foo:baz gg:[123]]", fmt.Sprint(doc))
+}
+
+func Test_JsonPatch_ApplyOpsAtomic_LeavesDocumentUnchangedOnError(t *testing.T) {
+	b1 := []byte(`{
+		"foo": "bar",
+		"arr": [1, 2, 3]
+	}`)
+	b2 := []byte(`[
+		{"op": "replace", "path": "/foo", "value": "baz"},
+		{"op": "add", "path": "/arr/1", "value": 5},
+		{"op": "remove", "path": "/arr/0"},
+		{"op": "move", "path": "/x", "from": "/arr"},
+		{"op": "test", "path": "/foo", "value": "bar"}
+	]`)
+	var doc interface{}
+	var patch interface{}
+	json.Unmarshal(b1, &doc)
+	json.Unmarshal(b2, &patch)
+	ops, _, _ := CreateOps(patch)
+	index, err := ApplyOpsAtomic(&doc, ops)
+	assert.True(t, errors.Is(err, ErrTest))
+	assert.Equal(t, 4, index)
+	assert.Equal(t, "map[arr:[1 2 3] foo:bar]", fmt.Sprint(doc))
+}
+
+func Test_JsonPatch_ApplyOps_StrDelVerifiesDeletedString(t *testing.T) {
+	doc := parseJSON(`{"a": "xyz abc"}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "str_del", "path": "/a", "pos": 4, "str": "abc"}
+	]`))
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, parseJSON(`{"a": "xyz "}`), doc)
+	ops, _, _ = CreateOps(parseJSON(`[
+		{"op": "str_del", "path": "/a", "pos": 0, "str": "abc"}
+	]`))
+	err := ApplyOps(&doc, ops)
+	assert.True(t, errors.Is(err, ErrStringMismatch))
+	assert.Equal(t, "STR_MISMATCH: operation 0 (str_del)", err.Error())
+	assert.Equal(t, parseJSON(`{"a": "xyz "}`), doc)
+}
+
+func Test_JsonPatch_ApplyOps_StrDelFailsWhenStringIsTooShort(t *testing.T) {
+	doc := parseJSON(`{"a": "ab"}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "str_del", "path": "/a", "pos": 1, "str": "bc"}
+	]`))
+	assert.True(t, errors.Is(ApplyOps(&doc, ops), ErrStringMismatch))
+}
+
+func Test_JsonPatch_ApplyOps_CoercesValuesByDefault(t *testing.T) {
+	doc := parseJSON(`{"a": {}, "b": "x", "c": "", "d": "abc", "e": [0, null]}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "inc", "path": "/a", "inc": 1},
+		{"op": "inc", "path": "/b", "inc": 1},
+		{"op": "flip", "path": "/c"},
+		{"op": "flip", "path": "/d"},
+		{"op": "flip", "path": "/e/0"},
+		{"op": "inc", "path": "/e/1", "inc": 2},
+		{"op": "str_ins", "path": "/f", "pos": 0, "str": "new"}
+	]`))
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, parseJSON(`{"a": 2, "b": 1, "c": true, "d": false, "e": [true, 2], "f": "new"}`), doc)
+}
+
+func Test_JsonPatch_ApplyOps_FailsInsideScalar(t *testing.T) {
+	for _, patch := range []string{
+		`[{"op": "inc", "path": "/a/b", "inc": 1}]`,
+		`[{"op": "flip", "path": "/a/b"}]`,
+		`[{"op": "str_ins", "path": "/a/b", "pos": 0, "str": "x"}]`,
+	} {
+		doc := parseJSON(`{"a": 1}`)
+		ops, _, _ := CreateOps(parseJSON(patch))
+		assert.True(t, errors.Is(ApplyOps(&doc, ops), ErrNotFound), patch)
+	}
+}
+
+func Test_JsonPatch_ApplyOpsWithOptions_Strict(t *testing.T) {
+	cases := []struct {
+		patch string
+		err   error
+	}{
+		{`[{"op": "inc", "path": "/n", "inc": 1}, {"op": "inc", "path": "/s", "inc": 1}]`, ErrNotANumber},
+		{`[{"op": "inc", "path": "/a/0", "inc": 1}, {"op": "inc", "path": "/a/1", "inc": 1}]`, ErrNotANumber},
+		{`[{"op": "flip", "path": "/b"}, {"op": "flip", "path": "/n"}]`, ErrNotABoolean},
+		{`[{"op": "flip", "path": "/b"}, {"op": "flip", "path": ""}]`, ErrNotABoolean},
+		{`[{"op": "str_ins", "path": "/s", "pos": 1, "str": "x"}, {"op": "str_ins", "path": "/x", "pos": 0, "str": "x"}]`, ErrNotFound},
+		{`[{"op": "inc", "path": "/n", "inc": 1}, {"op": "inc", "path": "/x", "inc": 1}]`, ErrNotFound},
+		{`[{"op": "flip", "path": "/b"}, {"op": "flip", "path": "/x"}]`, ErrNotFound},
+	}
+	for _, c := range cases {
+		doc := parseJSON(`{"n": 1, "s": "1", "b": true, "a": [1, null]}`)
+		ops, _, _ := CreateOps(parseJSON(c.patch))
+		err := ApplyOpsWithOptions(&doc, ops, ApplyOptions{Strict: true})
+		assert.True(t, errors.Is(err, c.err), c.patch)
+		assert.Equal(t, 1, err.(*PatchError).Index, c.patch)
+	}
+}
+
+func Test_JsonPatch_ApplyOpsWithOptions_StrictAppliesValidOperations(t *testing.T) {
+	doc := parseJSON(`{"n": 1, "b": [true], "s": "ab"}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "inc", "path": "/n", "inc": 2},
+		{"op": "flip", "path": "/b/0"},
+		{"op": "str_ins", "path": "/s", "pos": 1, "str": "x"}
+	]`))
+	assert.Nil(t, ApplyOpsWithOptions(&doc, ops, ApplyOptions{Strict: true}))
+	assert.Equal(t, parseJSON(`{"n": 3, "b": [false], "s": "axb"}`), doc)
+}
+
+func Test_JsonPatch_ApplyOpsWithOptions_StrictIncAcceptsGoNumbers(t *testing.T) {
+	doc := JSON(map[string]JSON{
+		"a": 1, "b": int8(1), "c": int16(1), "d": int32(1), "e": int64(1),
+		"f": uint(1), "g": uint8(1), "h": uint16(1), "i": uint32(1), "j": uint64(1),
+		"k": float32(1), "l": float64(1),
+	})
+	ops := []Op{}
+	for key := range doc.(map[string]JSON) {
+		ops = append(ops, &OpInc{path: JSONPointer{key}, inc: 1})
+	}
+	assert.Nil(t, ApplyOpsWithOptions(&doc, ops, ApplyOptions{Strict: true}))
+	for key, value := range doc.(map[string]JSON) {
+		assert.Equal(t, float64(2), value, key)
+	}
+}
+
+func Test_JsonPatch_ApplyOpsWithOptions_StrictAtomic(t *testing.T) {
+	doc := parseJSON(`{"n": 1, "s": "1", "a": [1]}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "inc", "path": "/n", "inc": 1},
+		{"op": "add", "path": "/a/-", "value": 2},
+		{"op": "inc", "path": "/s", "inc": 1}
+	]`))
+	err := ApplyOpsWithOptions(&doc, ops, ApplyOptions{Strict: true, Atomic: true})
+	assert.True(t, errors.Is(err, ErrNotANumber))
+	assert.Equal(t, 2, err.(*PatchError).Index)
+	assert.Equal(t, parseJSON(`{"n": 1, "s": "1", "a": [1]}`), doc)
+	ops = ops[:2]
+	assert.Nil(t, ApplyOpsWithOptions(&doc, ops, ApplyOptions{Strict: true, Atomic: true}))
+	assert.Equal(t, parseJSON(`{"n": 2, "s": "1", "a": [1, 2]}`), doc)
+}
+
+func Test_JsonPatch_ApplyOpsWithOptions_CloneLeavesOriginalUnchanged(t *testing.T) {
+	doc := parseJSON(`{"a": {"b": [1]}}`)
+	original := doc
+	inner := doc.(map[string]JSON)["a"]
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/a/b/-", "value": 2},
+		{"op": "add", "path": "/c", "value": 3}
+	]`))
+	assert.Nil(t, ApplyOpsWithOptions(&doc, ops, ApplyOptions{Clone: true}))
+	assert.Equal(t, parseJSON(`{"a": {"b": [1, 2]}, "c": 3}`), doc)
+	assert.Equal(t, parseJSON(`{"a": {"b": [1]}}`), original)
+	assert.Equal(t, parseJSON(`{"b": [1]}`), inner)
+}
+
+func Test_JsonPatch_ApplyOpsWithOptions_CloneKeepsDocumentOnError(t *testing.T) {
+	doc := parseJSON(`{"a": 1}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/b", "value": 2},
+		{"op": "remove", "path": "/c"}
+	]`))
+	err := ApplyOpsWithOptions(&doc, ops, ApplyOptions{Clone: true})
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, 1, err.(*PatchError).Index)
+	assert.Equal(t, parseJSON(`{"a": 1}`), doc)
+}
+
+func Test_JsonPatch_ApplyOpsWithOptions_AllowedOps(t *testing.T) {
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/b", "value": 2},
+		{"op": "test", "path": "/a", "value": 1},
+		{"op": "inc", "path": "/a", "inc": 1}
+	]`))
+	doc := parseJSON(`{"a": 1}`)
+	err := ApplyOpsWithOptions(&doc, ops, ApplyOptions{AllowedOps: RFC6902Ops()})
+	assert.True(t, errors.Is(err, ErrOperationNotAllowed))
+	assert.Equal(t, "OP_NOT_ALLOWED: operation 2 (inc)", err.Error())
+	assert.Equal(t, parseJSON(`{"a": 1}`), doc, "nothing is applied")
+	assert.Nil(t, ApplyOpsWithOptions(&doc, ops[:2], ApplyOptions{AllowedOps: RFC6902Ops()}))
+	assert.Equal(t, parseJSON(`{"a": 1, "b": 2}`), doc)
+}
+
+func Test_JsonPatch_ApplyOpsWithOptions_AllowedOpsRejectsNegatedTest(t *testing.T) {
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "test", "path": "/a", "value": 2, "not": true}
+	]`))
+	doc := parseJSON(`{"a": 1}`)
+	err := ApplyOpsWithOptions(&doc, ops, ApplyOptions{AllowedOps: RFC6902Ops()})
+	assert.True(t, errors.Is(err, ErrOperationNotAllowed))
+	assert.Equal(t, 0, err.(*PatchError).Index)
+	assert.Nil(t, ApplyOpsWithOptions(&doc, ops, ApplyOptions{AllowedOps: []string{"test", "not"}}))
+}
+
+func Test_JsonPatch_RFC6902Ops_ReturnsNewSlice(t *testing.T) {
+	ops := RFC6902Ops()
+	ops[0] = "inc"
+	assert.Equal(t, "add", RFC6902Ops()[0])
+}
+
+func Test_JsonPatch_ApplyOpsWithOptions_AllowedOpsChecksNestedPredicates(t *testing.T) {
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "and", "path": "", "apply": [{"op": "defined", "path": "/a"}, {"op": "less", "path": "/a", "value": 5}]}
+	]`))
+	doc := parseJSON(`{"a": 1}`)
+	err := ApplyOpsWithOptions(&doc, ops, ApplyOptions{AllowedOps: []string{"and", "defined"}})
+	assert.True(t, errors.Is(err, ErrOperationNotAllowed))
+	assert.Nil(t, ApplyOpsWithOptions(&doc, ops, ApplyOptions{AllowedOps: []string{"and", "defined", "less"}}))
+}
+
+func Test_JsonPatch_ApplyOpsWithOptions_MaxOps(t *testing.T) {
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "add", "path": "/b", "value": 2},
+		{"op": "add", "path": "/c", "value": 3}
+	]`))
+	doc := parseJSON(`{}`)
+	err := ApplyOpsWithOptions(&doc, ops, ApplyOptions{MaxOps: 1})
+	assert.True(t, errors.Is(err, ErrPatchTooLarge))
+	assert.Equal(t, -1, err.(*PatchError).Index)
+	assert.Equal(t, parseJSON(`{}`), doc)
+	assert.Nil(t, ApplyOpsWithOptions(&doc, ops, ApplyOptions{MaxOps: 2}))
+}
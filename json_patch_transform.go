@@ -0,0 +1,790 @@
+package jsonjoy
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Transform transforms two patches created against the same document so that
+// they can be applied one after another in either order: applying a and then
+// the returned b' results in the same document as applying b and then the
+// returned a'. Operations of a win when both patches write the same location.
+//
+// Reference tokens which are non-negative integers are treated as array
+// indices. Operations which lose their target, for example an "inc" on a
+// value removed by the other patch, are dropped. A write which replaces the
+// source of a concurrent move wins over the moved value, which is lost in the
+// other order. Moves which overwrite each other's source lose both values.
+// Elements appended using "-"
+// do not shift other operations, so concurrent edits addressing the end of
+// an array by index are not adjusted.
+func Transform(a []Op, b []Op) ([]Op, []Op) {
+	a2, b2, _ := transformPatch(a, b, true)
+	return a2, b2
+}
+
+// transformPatch transforms patches a and b against each other, returns the
+// number of operations of a which were dropped or lost a written value
+// because their target was removed or written by b.
+func transformPatch(a []Op, b []Op, aPriority bool) ([]Op, []Op, int) {
+	if len(a) == 0 || len(b) == 0 {
+		return a, b, 0
+	}
+	if len(a) == 1 && len(b) == 1 {
+		a2, conflict := transformOp(a[0], b[0], aPriority)
+		b2, _ := transformOp(b[0], a[0], !aPriority)
+		if conflict {
+			return a2, b2, 1
+		}
+		return a2, b2, 0
+	}
+	if len(a) > 1 {
+		a1, b1, c1 := transformPatch(a[:1], b, aPriority)
+		a2, b2, c2 := transformPatch(a[1:], b1, aPriority)
+		return append(a1, a2...), b2, c1 + c2
+	}
+	a1, b1, c1 := transformPatch(a, b[:1], aPriority)
+	a2, b2, c2 := transformPatch(a1, b[1:], aPriority)
+	return a2, append(b1, b2...), c1 + c2
+}
+
+type editKind int
+
+const (
+	// editInsert is an element inserted into an array.
+	editInsert editKind = iota
+	// editDelete is a value removed from its parent.
+	editDelete
+	// editWrite is a value replaced by a new one.
+	editWrite
+	// editModify is a value changed in place.
+	editModify
+)
+
+// pathEdit describes how an operation changes document structure.
+type pathEdit struct {
+	kind editKind
+	path JSONPointer
+}
+
+// isIndexToken checks if reference token is an array index.
+func isIndexToken(token string) bool {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return false
+	}
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isInsertPath checks if a value added at path is inserted into an array.
+func isInsertPath(path JSONPointer) bool {
+	if len(path) == 0 {
+		return false
+	}
+	last := path[len(path)-1]
+	return last == "-" || isIndexToken(last)
+}
+
+func setEdit(path JSONPointer) pathEdit {
+	if isInsertPath(path) {
+		return pathEdit{kind: editInsert, path: path}
+	}
+	return pathEdit{kind: editWrite, path: path}
+}
+
+// opEdits returns structural changes made by op, in order of application.
+func opEdits(op Op) []pathEdit {
+	switch o := op.(type) {
+	case *OpAdd:
+		return []pathEdit{setEdit(o.path)}
+	case *OpCopy:
+		return []pathEdit{setEdit(o.path)}
+	case *OpReplace:
+		return []pathEdit{{kind: editWrite, path: o.path}}
+	case *OpRemove:
+		return []pathEdit{{kind: editDelete, path: o.path}}
+	case *OpMove:
+		if equalPointers(o.from, o.path) {
+			return nil
+		}
+		return []pathEdit{{kind: editDelete, path: o.from}, setEdit(o.path)}
+	case *OpInc, *OpStrIns, *OpStrDel, *OpFlip:
+		return []pathEdit{{kind: editModify, path: op.Path()}}
+	case *OpSplit:
+		if len(o.path) > 0 && isIndexToken(o.path[len(o.path)-1]) {
+			index, _ := strconv.Atoi(o.path[len(o.path)-1])
+			return []pathEdit{
+				{kind: editWrite, path: o.path},
+				{kind: editInsert, path: withLastToken(o.path, strconv.Itoa(index+1))},
+			}
+		}
+		return []pathEdit{{kind: editWrite, path: o.path}}
+	case *OpMerge:
+		if len(o.path) > 0 && isIndexToken(o.path[len(o.path)-1]) {
+			index, _ := strconv.Atoi(o.path[len(o.path)-1])
+			if index > 0 {
+				return []pathEdit{
+					{kind: editWrite, path: withLastToken(o.path, strconv.Itoa(index-1))},
+					{kind: editDelete, path: o.path},
+				}
+			}
+		}
+		return []pathEdit{{kind: editModify, path: o.path}}
+	case *OpExtend:
+		edits := []pathEdit{{kind: editModify, path: o.path}}
+		for _, key := range sortedKeys(o.props) {
+			kind := editWrite
+			if o.deleteNull && o.props[key] == nil {
+				kind = editDelete
+			}
+			edits = append(edits, pathEdit{kind: kind, path: appendToken(o.path, key)})
+		}
+		return edits
+	}
+	return nil
+}
+
+func sortedKeys(obj map[string]JSON) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type pathRelation int
+
+const (
+	// relNone means location is not affected, but may have been shifted.
+	relNone pathRelation = iota
+	// relEqual means location is the one changed by the edit.
+	relEqual
+	// relInside means location is inside a removed or replaced value.
+	relInside
+)
+
+// transformPath shifts array indices of location q after edit e. When
+// inserts is set, q is the location of an element inserted into an array,
+// which stays in front of an element concurrently inserted at the same index
+// if stay is set.
+func transformPath(q JSONPointer, e pathEdit, inserts bool, stay bool) (JSONPointer, pathRelation) {
+	p := e.path
+	if len(p) > 0 && isIndexToken(p[len(p)-1]) && (e.kind == editInsert || e.kind == editDelete) {
+		depth := len(p) - 1
+		if len(q) <= depth || !equalPointers(q[:depth], p[:depth]) || !isIndexToken(q[depth]) {
+			return q, relNone
+		}
+		i, _ := strconv.Atoi(p[depth])
+		j, _ := strconv.Atoi(q[depth])
+		exact := len(q) == len(p)
+		switch {
+		case e.kind == editInsert && (j > i || (j == i && !(exact && inserts && stay))):
+			return withToken(q, depth, strconv.Itoa(j+1)), relNone
+		case e.kind == editDelete && j > i:
+			return withToken(q, depth, strconv.Itoa(j-1)), relNone
+		case e.kind == editDelete && j == i:
+			if exact && inserts {
+				return q, relNone
+			}
+			if exact {
+				return q, relEqual
+			}
+			return q, relInside
+		}
+		return q, relNone
+	}
+	if e.kind == editInsert {
+		return q, relNone
+	}
+	if equalPointers(q, p) {
+		if inserts && len(p) > 0 && isIndexToken(p[len(p)-1]) {
+			return q, relNone
+		}
+		return q, relEqual
+	}
+	if e.kind != editModify && isPrefix(p, q) {
+		return q, relInside
+	}
+	return q, relNone
+}
+
+// withToken returns a copy of JSON Pointer with token at index replaced.
+func withToken(tokens JSONPointer, index int, token string) JSONPointer {
+	res := make(JSONPointer, len(tokens))
+	copy(res, tokens)
+	res[index] = token
+	return res
+}
+
+// followMove returns location q rewritten to point into the value moved by
+// op, or false if q is outside of the moved value.
+func followMove(q JSONPointer, op *OpMove) (JSONPointer, bool) {
+	if !(equalPointers(q, op.from) || isPrefix(op.from, q)) {
+		return q, false
+	}
+	res := make(JSONPointer, 0, len(op.path)+len(q)-len(op.from))
+	res = append(res, op.path...)
+	return append(res, q[len(op.from):]...), true
+}
+
+// holdsTarget checks if the value moved by op is written at or inside of
+// location p. A value inserted into an array at p is not.
+func holdsTarget(p JSONPointer, op *OpMove) bool {
+	return isPrefix(p, op.path) || (equalPointers(p, op.path) && !isInsertPath(op.path))
+}
+
+// overwritesSource checks if a value written at path contains the source of
+// value moved by against, so that the moved value is lost when the write is
+// applied first.
+func overwritesSource(path JSONPointer, against Op) bool {
+	move, ok := against.(*OpMove)
+	return ok && isPrefix(path, move.from)
+}
+
+// moveTarget returns target of move as located before the value is removed
+// from its source, for example "/1/x" for a move from "/0" to "/0/x".
+func moveTarget(op *OpMove) JSONPointer {
+	target, _ := transformPath(op.path, pathEdit{kind: editInsert, path: op.from}, false, false)
+	return target
+}
+
+// canFollowMove checks if locations inside value moved by op can be tracked.
+func canFollowMove(op *OpMove) bool {
+	if equalPointers(op.from, op.path) || op.from.IsRoot() || isPrefix(op.from, moveTarget(op)) {
+		return false
+	}
+	return len(op.path) == 0 || op.path[len(op.path)-1] != "-"
+}
+
+type opClass int
+
+const (
+	classInsert opClass = iota
+	classWrite
+	classDelete
+	classModify
+	classRead
+)
+
+func classOf(op Op) opClass {
+	switch o := op.(type) {
+	case *OpAdd:
+		if isInsertPath(o.path) {
+			return classInsert
+		}
+		return classWrite
+	case *OpCopy:
+		if isInsertPath(o.path) {
+			return classInsert
+		}
+		return classWrite
+	case *OpReplace:
+		return classWrite
+	case *OpRemove:
+		return classDelete
+	case *OpInc, *OpStrIns, *OpStrDel, *OpFlip, *OpSplit, *OpMerge, *OpExtend:
+		return classModify
+	}
+	return classRead
+}
+
+// transformOp transforms op so that it can be applied after against, both
+// being created against the same document. Returns true if op, or a value
+// written by it, was dropped because its target was removed or replaced by
+// against.
+func transformOp(op Op, against Op, priority bool) ([]Op, bool) {
+	if ops, ok := transformText(op, against, priority); ok {
+		return ops, false
+	}
+	if move, ok := op.(*OpMove); ok {
+		return transformMove(move, against, priority)
+	}
+	if move, ok := against.(*OpMove); ok && canFollowMove(move) && destroysSource(op, move) {
+		// Value moved out of a subtree which op removes or replaces is removed
+		// too, as if it was moved after op.
+		return transformOverLostMove(op, move, priority)
+	}
+	if move, ok := against.(*OpMove); ok && canFollowMove(move) && classOf(op) == classWrite && equalPointers(op.Path(), move.from) {
+		// Value written at the source of move is written at its target.
+		switch o := op.(type) {
+		case *OpAdd:
+			return []Op{&OpReplace{path: move.path, value: o.value}}, false
+		case *OpReplace:
+			return []Op{&OpReplace{path: move.path, value: o.value}}, false
+		}
+	}
+	var from JSONPointer
+	if copyOp, ok := op.(*OpCopy); ok {
+		var rel pathRelation
+		var kind editKind
+		from, rel, kind = transformLocation(copyOp.from, against, false, false)
+		if rel == relInside || (rel == relEqual && kind == editDelete) {
+			return nil, true
+		}
+	}
+	class := classOf(op)
+	path, rel, kind := transformLocation(op.Path(), against, class == classInsert, priority)
+	switch rel {
+	case relInside:
+		return nil, class != classDelete
+	case relEqual:
+		switch class {
+		case classModify, classRead:
+			return nil, true
+		case classDelete:
+			if (!priority && !overwritesSource(op.Path(), against)) || kind == editDelete {
+				return nil, false
+			}
+		case classWrite:
+			if !priority && !overwritesSource(op.Path(), against) {
+				return nil, true
+			}
+			if replace, ok := op.(*OpReplace); ok && kind == editDelete {
+				return []Op{&OpAdd{path: path, value: replace.value}}, false
+			}
+		}
+	}
+	if ext, ok := op.(*OpExtend); ok {
+		return transformExtend(ext, path, against, priority)
+	}
+	return []Op{withPaths(op, path, from)}, false
+}
+
+// transformExtend transforms properties of "extend" operation, which is
+// moved to path. Properties written by against take precedence unless
+// priority is set, a property which is moved by against is written at the
+// target of the move. Returns true if a property was dropped.
+func transformExtend(op *OpExtend, path JSONPointer, against Op, priority bool) ([]Op, bool) {
+	ops := []Op{}
+	dropped := false
+	props := map[string]JSON{}
+	for key, value := range op.props {
+		location := appendToken(op.path, key)
+		if move, ok := against.(*OpMove); ok && canFollowMove(move) && equalPointers(location, move.from) {
+			if op.deleteNull && value == nil {
+				ops = append(ops, &OpRemove{path: move.path})
+			} else {
+				ops = append(ops, &OpReplace{path: move.path, value: value})
+			}
+			continue
+		}
+		_, rel, kind := transformLocation(location, against, false, priority)
+		if priority || rel != relEqual || kind == editModify {
+			props[key] = value
+		} else {
+			dropped = true
+		}
+	}
+	if len(props) > 0 {
+		ops = append(ops, &OpExtend{path: path, props: props, deleteNull: op.deleteNull})
+	}
+	return ops, dropped
+}
+
+// destroysSource checks if op removes or replaces a value which contains the
+// source of move, but not its target.
+func destroysSource(op Op, move *OpMove) bool {
+	for _, e := range opEdits(op) {
+		if e.kind != editWrite && e.kind != editDelete {
+			continue
+		}
+		if isPrefix(e.path, move.from) && !holdsTarget(e.path, move) {
+			return true
+		}
+	}
+	return false
+}
+
+// transformLocation transforms location q so that it points to the same
+// value after against is applied. Returns relation of q to the first edit of
+// against which removes or replaces the value at q or its parent.
+func transformLocation(q JSONPointer, against Op, inserts bool, stay bool) (JSONPointer, pathRelation, editKind) {
+	if move, ok := against.(*OpMove); ok && canFollowMove(move) && !(inserts && len(q) == len(move.from)) {
+		if moved, ok := followMove(q, move); ok {
+			return moved, relNone, editModify
+		}
+	}
+	for _, e := range opEdits(against) {
+		var rel pathRelation
+		q, rel = transformPath(q, e, inserts, stay)
+		if rel != relNone && e.kind != editModify {
+			return q, rel, e.kind
+		}
+	}
+	return q, relNone, editModify
+}
+
+// transformMove transforms "move" operation. Its source is transformed as a
+// location which is read and its target as a location which is written. If
+// the target is lost, the moved value is removed, as it would be overwritten
+// or removed by against. If the moved value is lost, a value overwritten by
+// the move at an object key is removed as well.
+func transformMove(op *OpMove, against Op, priority bool) ([]Op, bool) {
+	if equalPointers(op.from, op.path) {
+		return nil, false
+	}
+	if move, ok := against.(*OpMove); ok && !priority && canFollowMove(move) && equalPointers(op.from, move.from) {
+		// Value is already moved by against, op loses it unless it moves it
+		// to the same location.
+		if equalPointers(op.path, move.path) {
+			return nil, false
+		}
+		return dropMove(op, against, priority), true
+	}
+	target := moveTarget(op)
+	if move, ok := against.(*OpMove); ok && canFollowMove(move) && !isInsertPath(op.path) &&
+		!equalPointers(op.from, move.from) && equalPointers(target, move.from) {
+		return transformMoveOverSource(op, move)
+	}
+	if move, ok := against.(*OpMove); ok && canFollowMove(move) && !isInsertPath(op.path) &&
+		!equalPointers(op.from, move.from) && isPrefix(target, move.from) && !holdsTarget(target, move) {
+		// Target of op overwrites a value from which against moves a value out.
+		return transformOverLostMove(op, move, priority)
+	}
+	from, rel, kind := transformLocation(op.from, against, false, false)
+	if rel == relInside || (rel == relEqual && kind == editDelete) {
+		return dropMove(op, against, priority), true
+	}
+	if move, ok := against.(*OpMove); ok && canFollowMove(move) && equalPointers(op.from, move.from) {
+		return moveOrRemove(from, op.path)
+	}
+	// Target is located after the value is removed from its source, so it is
+	// transformed over against as seen after the removal. A value which
+	// against moves out of the removed one is still added at its target.
+	removed := against
+	if move, ok := against.(*OpMove); ok && isPrefix(op.from, move.from) {
+		removed = &OpAdd{path: move.path}
+	}
+	shifted, _ := transformOp(removed, &OpRemove{path: op.from}, false)
+	path := op.path
+	for _, other := range shifted {
+		var rel pathRelation
+		var kind editKind
+		path, rel, kind = transformLocation(path, other, isInsertPath(op.path), priority)
+		if rel == relInside || (rel == relEqual && kind != editModify && !priority && !overwritesSource(target, against)) {
+			return []Op{&OpRemove{path: from}}, true
+		}
+	}
+	return moveOrRemove(from, path)
+}
+
+// transformOverLostMove transforms op over move whose source op removes or
+// replaces. The moved value is removed from the target of move, then op is
+// applied as if move only removed its source.
+func transformOverLostMove(op Op, move *OpMove, priority bool) ([]Op, bool) {
+	ops, conflict := transformOp(op, &OpRemove{path: move.from}, priority)
+	if !isInsertPath(move.path) {
+		var conflicts int
+		ops, _, conflicts = transformPatch(ops, []Op{&OpRemove{path: move.path}}, priority)
+		conflict = conflict || conflicts > 0
+	}
+	return append([]Op{&OpRemove{path: move.path}}, ops...), conflict
+}
+
+// transformMoveOverSource transforms "move" op which overwrites the source of
+// against. As with other writes, the value is written at the target of
+// against instead. When against in turn overwrites the source of op, both
+// moved values are lost and removed.
+func transformMoveOverSource(op *OpMove, against *OpMove) ([]Op, bool) {
+	from, rel, _ := transformLocation(op.from, against, false, false)
+	if rel == relInside {
+		// Value of op is lost as well.
+		return []Op{&OpRemove{path: against.path}}, true
+	}
+	if !isInsertPath(against.path) {
+		if equalPointers(op.from, against.path) {
+			return []Op{&OpRemove{path: from}}, true
+		}
+		return moveOrRemove(from, afterRemoval(against.path, from))
+	}
+	// Value inserted into an array by against is replaced.
+	if isPrefix(against.path, from) {
+		next, _ := transformPath(against.path, pathEdit{kind: editInsert, path: against.path}, false, false)
+		return []Op{&OpMove{from: from, path: against.path}, &OpRemove{path: next}}, false
+	}
+	from, _ = transformPath(from, pathEdit{kind: editDelete, path: against.path}, false, false)
+	if equalPointers(from, against.path) {
+		return []Op{&OpRemove{path: against.path}}, false
+	}
+	ops, conflict := moveOrRemove(from, afterRemoval(against.path, from))
+	return append([]Op{&OpRemove{path: against.path}}, ops...), conflict
+}
+
+// afterRemoval returns location q as seen after the value at from is
+// removed.
+func afterRemoval(q JSONPointer, from JSONPointer) JSONPointer {
+	res, _ := transformPath(q, pathEdit{kind: editDelete, path: from}, true, false)
+	return res
+}
+
+// moveOrRemove returns "move" operation, or removal of the value at from if
+// the target was transformed to a location inside of it. Then moves of op and
+// against form a cycle and neither of the moved values is kept.
+func moveOrRemove(from JSONPointer, path JSONPointer) ([]Op, bool) {
+	move := &OpMove{from: from, path: path}
+	if isPrefix(from, moveTarget(move)) {
+		return []Op{&OpRemove{path: from}}, true
+	}
+	return []Op{move}, false
+}
+
+// dropMove returns operations which replace "move" whose value is lost
+// because of against. A value at an object key overwritten by the move is
+// removed, as it is when op is applied before against. It is added first, so
+// that the removal succeeds whether the key exists or not.
+func dropMove(op *OpMove, against Op, priority bool) []Op {
+	if op.path.IsRoot() || isInsertPath(op.path) {
+		return nil
+	}
+	path, rel, _ := transformLocation(moveTarget(op), against, false, priority)
+	if rel != relNone {
+		return nil
+	}
+	return []Op{&OpAdd{path: path, value: nil}, &OpRemove{path: path}}
+}
+
+// transformText transforms string operations at the same location, returns
+// false if op and against are not both string operations on the same string
+// with positions in the same unit. Text inserted at the same position by op
+// stays in front if priority is set.
+func transformText(op Op, against Op, priority bool) ([]Op, bool) {
+	if !equalPointers(op.Path(), against.Path()) || textUnit(op) != textUnit(against) {
+		return nil, false
+	}
+	switch o := op.(type) {
+	case *OpStrIns:
+		switch a := against.(type) {
+		case *OpStrIns:
+			pos := o.pos
+			if a.pos < o.pos || (a.pos == o.pos && !priority) {
+				pos += stringLength(a.str, o.unit)
+			}
+			return []Op{&OpStrIns{path: o.path, pos: pos, str: o.str, unit: o.unit}}, true
+		case *OpStrDel:
+			pos := o.pos
+			if pos > a.pos+a.len {
+				pos -= a.len
+			} else if pos > a.pos {
+				pos = a.pos
+			}
+			return []Op{&OpStrIns{path: o.path, pos: pos, str: o.str, unit: o.unit}}, true
+		}
+	case *OpStrDel:
+		switch a := against.(type) {
+		case *OpStrIns:
+			switch {
+			case a.pos <= o.pos:
+				return []Op{strDel(o, o.pos+stringLength(a.str, o.unit), 0, o.len)}, true
+			case a.pos >= o.pos+o.len:
+				return []Op{strDel(o, o.pos, 0, o.len)}, true
+			}
+			before := a.pos - o.pos
+			return []Op{
+				strDel(o, o.pos, 0, before),
+				strDel(o, o.pos+stringLength(a.str, o.unit), before, o.len),
+			}, true
+		case *OpStrDel:
+			start, end := o.pos, o.pos+o.len
+			overlap := minInt(end, a.pos+a.len) - maxInt(start, a.pos)
+			if overlap < 0 {
+				overlap = 0
+			}
+			if o.len == overlap {
+				return nil, true
+			}
+			pos := start
+			if start > a.pos {
+				pos = maxInt(a.pos, start-a.len)
+			}
+			res := &OpStrDel{path: o.path, pos: pos, len: o.len - overlap, unit: o.unit}
+			if o.str != "" {
+				res.str = deleteString(o.str, maxInt(a.pos-start, 0), overlap, o.unit)
+			}
+			return []Op{res}, true
+		}
+	}
+	return nil, false
+}
+
+// strDel returns "str_del" operation at pos which deletes part of text
+// deleted by op between positions start and end, relative to op.
+func strDel(op *OpStrDel, pos int, start int, end int) *OpStrDel {
+	res := &OpStrDel{path: op.path, pos: pos, len: end - start, unit: op.unit}
+	if op.str != "" {
+		res.str = substring(op.str, start, end, op.unit)
+	}
+	return res
+}
+
+// textUnit returns unit of positions of a string operation.
+func textUnit(op Op) PositionUnit {
+	switch o := op.(type) {
+	case *OpStrIns:
+		return o.unit
+	case *OpStrDel:
+		return o.unit
+	}
+	return PositionUTF16
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// withPaths returns a copy of op with new "path" and, for "move" and "copy"
+// operations, new "from". Children of composite predicates are moved along.
+func withPaths(op Op, path JSONPointer, from JSONPointer) Op {
+	switch o := op.(type) {
+	case *OpAdd:
+		res := *o
+		res.path = path
+		return &res
+	case *OpRemove:
+		res := *o
+		res.path = path
+		return &res
+	case *OpReplace:
+		res := *o
+		res.path = path
+		return &res
+	case *OpMove:
+		res := *o
+		res.path, res.from = path, from
+		return &res
+	case *OpCopy:
+		res := *o
+		res.path, res.from = path, from
+		return &res
+	case *OpStrIns:
+		res := *o
+		res.path = path
+		return &res
+	case *OpStrDel:
+		res := *o
+		res.path = path
+		return &res
+	case *OpFlip:
+		res := *o
+		res.path = path
+		return &res
+	case *OpInc:
+		res := *o
+		res.path = path
+		return &res
+	case *OpSplit:
+		res := *o
+		res.path = path
+		return &res
+	case *OpMerge:
+		res := *o
+		res.path = path
+		return &res
+	case *OpExtend:
+		res := *o
+		res.path = path
+		return &res
+	case PredicateOp:
+		return predicateWithPath(o, path)
+	}
+	return op
+}
+
+func predicateWithPath(op PredicateOp, path JSONPointer) PredicateOp {
+	switch o := op.(type) {
+	case *OpTest:
+		res := *o
+		res.path = path
+		return &res
+	case *OpDefined:
+		res := *o
+		res.path = path
+		return &res
+	case *OpUndefined:
+		res := *o
+		res.path = path
+		return &res
+	case *OpType:
+		res := *o
+		res.path = path
+		return &res
+	case *OpTestType:
+		res := *o
+		res.path = path
+		return &res
+	case *OpStarts:
+		res := *o
+		res.path = path
+		return &res
+	case *OpEnds:
+		res := *o
+		res.path = path
+		return &res
+	case *OpContains:
+		res := *o
+		res.path = path
+		return &res
+	case *OpMatches:
+		res := *o
+		res.path = path
+		return &res
+	case *OpTestString:
+		res := *o
+		res.path = path
+		return &res
+	case *OpTestStringLen:
+		res := *o
+		res.path = path
+		return &res
+	case *OpLess:
+		res := *o
+		res.path = path
+		return &res
+	case *OpMore:
+		res := *o
+		res.path = path
+		return &res
+	case *OpIn:
+		res := *o
+		res.path = path
+		return &res
+	case *OpAnd:
+		res := *o
+		res.path, res.ops = path, childrenWithPath(o.ops, o.path, path)
+		return &res
+	case *OpOr:
+		res := *o
+		res.path, res.ops = path, childrenWithPath(o.ops, o.path, path)
+		return &res
+	case *OpNot:
+		res := *o
+		res.path, res.ops = path, childrenWithPath(o.ops, o.path, path)
+		return &res
+	}
+	return op
+}
+
+// childrenWithPath moves children of a composite predicate from parent
+// location prev to path.
+func childrenWithPath(ops []PredicateOp, prev JSONPointer, path JSONPointer) []PredicateOp {
+	res := make([]PredicateOp, len(ops))
+	for index, op := range ops {
+		childPath := append(append(JSONPointer{}, path...), op.Path()[len(prev):]...)
+		res[index] = predicateWithPath(op, childPath)
+	}
+	return res
+}
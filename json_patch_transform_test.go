@@ -0,0 +1,257 @@
+package jsonjoy
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var transformCases = []struct {
+	name   string
+	doc    string
+	a      string
+	b      string
+	result string
+}{
+	{"independent keys", `{"a": 1, "b": 2}`,
+		`[{"op": "replace", "path": "/a", "value": 10}]`,
+		`[{"op": "remove", "path": "/b"}]`,
+		`{"a": 10}`},
+	{"inserts into array", `[1, 2, 3]`,
+		`[{"op": "add", "path": "/1", "value": "a"}]`,
+		`[{"op": "add", "path": "/2", "value": "b"}]`,
+		`[1, "a", 2, "b", 3]`},
+	{"inserts at same index", `[1, 2]`,
+		`[{"op": "add", "path": "/1", "value": "a"}]`,
+		`[{"op": "add", "path": "/1", "value": "b"}]`,
+		`[1, "a", "b", 2]`},
+	{"insert and remove", `[1, 2, 3]`,
+		`[{"op": "add", "path": "/1", "value": "a"}]`,
+		`[{"op": "remove", "path": "/0"}, {"op": "remove", "path": "/1"}]`,
+		`["a", 2]`},
+	{"insert at removed index", `[1, 2, 3]`,
+		`[{"op": "add", "path": "/1", "value": "a"}]`,
+		`[{"op": "remove", "path": "/1"}]`,
+		`[1, "a", 3]`},
+	{"edits shifted by removal", `[{"x": 1}, {"x": 2}, {"x": 3}]`,
+		`[{"op": "replace", "path": "/2/x", "value": 30}, {"op": "inc", "path": "/1/x", "inc": 5}]`,
+		`[{"op": "remove", "path": "/0"}]`,
+		`[{"x": 7}, {"x": 30}]`},
+	{"edit inside removed value", `{"a": {"b": 1}, "c": 1}`,
+		`[{"op": "inc", "path": "/a/b", "inc": 1}, {"op": "inc", "path": "/c", "inc": 1}]`,
+		`[{"op": "remove", "path": "/a"}]`,
+		`{"c": 2}`},
+	{"both remove same value", `[1, 2, 3]`,
+		`[{"op": "remove", "path": "/1"}]`,
+		`[{"op": "remove", "path": "/1"}]`,
+		`[1, 3]`},
+	{"same path replace", `{"a": 1}`,
+		`[{"op": "replace", "path": "/a", "value": "a"}]`,
+		`[{"op": "replace", "path": "/a", "value": "b"}]`,
+		`{"a": "a"}`},
+	{"replace and remove", `{"a": 1, "b": 1}`,
+		`[{"op": "replace", "path": "/a", "value": 2}, {"op": "remove", "path": "/b"}]`,
+		`[{"op": "remove", "path": "/a"}, {"op": "replace", "path": "/b", "value": 2}]`,
+		`{"a": 2}`},
+	{"concurrent increments", `{"a": 1}`,
+		`[{"op": "inc", "path": "/a", "inc": 2}]`,
+		`[{"op": "inc", "path": "/a", "inc": 3}]`,
+		`{"a": 6}`},
+	{"inc on replaced value", `{"a": 1}`,
+		`[{"op": "inc", "path": "/a", "inc": 2}]`,
+		`[{"op": "replace", "path": "/a", "value": 10}]`,
+		`{"a": 10}`},
+	{"edits follow moved value", `{"a": {"b": "x"}, "c": []}`,
+		`[{"op": "str_ins", "path": "/a/b", "pos": 1, "str": "y"}, {"op": "add", "path": "/a/d", "value": 1}]`,
+		`[{"op": "move", "from": "/a", "path": "/c/0"}]`,
+		`{"c": [{"b": "xy", "d": 1}]}`},
+	{"move shifts indices", `[0, 1, 2, 3, 4]`,
+		`[{"op": "replace", "path": "/3", "value": "x"}, {"op": "remove", "path": "/0"}]`,
+		`[{"op": "move", "from": "/4", "path": "/1"}]`,
+		`[4, 1, 2, "x"]`},
+	{"move and remove source", `{"a": 1, "b": {}}`,
+		`[{"op": "remove", "path": "/a"}]`,
+		`[{"op": "move", "from": "/a", "path": "/b/a"}]`,
+		`{"b": {}}`},
+	{"moves of same value", `{"a": 1}`,
+		`[{"op": "move", "from": "/a", "path": "/b"}]`,
+		`[{"op": "move", "from": "/a", "path": "/c"}]`,
+		`{"b": 1}`},
+	{"move into removed value", `{"a": 1, "b": {}}`,
+		`[{"op": "move", "from": "/a", "path": "/b/a"}]`,
+		`[{"op": "remove", "path": "/b"}]`,
+		`{}`},
+	{"move over existing key and remove of its source", `{"p": null, "s": true}`,
+		`[{"op": "remove", "path": "/s"}]`,
+		`[{"op": "move", "from": "/s", "path": "/p"}]`,
+		`{}`},
+	{"remove of source and move over existing key", `{"p": null, "s": true}`,
+		`[{"op": "move", "from": "/s", "path": "/p"}]`,
+		`[{"op": "remove", "path": "/s"}]`,
+		`{}`},
+	{"moves of same value over existing keys", `{"p": 1, "q": 2, "s": 3}`,
+		`[{"op": "move", "from": "/s", "path": "/p"}]`,
+		`[{"op": "move", "from": "/s", "path": "/q"}]`,
+		`{"p": 3}`},
+	{"moves swapping keys", `{"p": 1, "q": 2}`,
+		`[{"op": "move", "from": "/p", "path": "/q"}]`,
+		`[{"op": "move", "from": "/q", "path": "/p"}]`,
+		`{}`},
+	{"move over source of other move", `{"p": 1, "q": 2, "r": {}}`,
+		`[{"op": "move", "from": "/p", "path": "/q"}]`,
+		`[{"op": "move", "from": "/q", "path": "/r/q"}]`,
+		`{"r": {"q": 1}}`},
+	{"move into shifted sibling and edit of moved value", `[{"p": null, "q": 1}, [], [0, 1]]`,
+		`[{"op": "move", "from": "/0", "path": "/1/2"}]`,
+		`[{"op": "remove", "path": "/0/p"}]`,
+		`[[], [0, 1, {"q": 1}]]`},
+	{"move over ancestor and replace of ancestor", `{"r": 4, "s": [[false, null]]}`,
+		`[{"op": "move", "from": "/s/0/0", "path": "/s"}]`,
+		`[{"op": "replace", "path": "/s", "value": null}]`,
+		`{"r": 4, "s": null}`},
+	{"remove of ancestor and move in front of it", `[[true, null], 4]`,
+		`[{"op": "remove", "path": "/0"}]`,
+		`[{"op": "move", "from": "/0/1", "path": "/0"}]`,
+		`[4]`},
+	{"text inserts", `{"s": "abc"}`,
+		`[{"op": "str_ins", "path": "/s", "pos": 1, "str": "x"}]`,
+		`[{"op": "str_ins", "path": "/s", "pos": 1, "str": "y"}, {"op": "str_ins", "path": "/s", "pos": 3, "str": "z"}]`,
+		`{"s": "axybzc"}`},
+	{"text insert into deleted range", `{"s": "abcdef"}`,
+		`[{"op": "str_ins", "path": "/s", "pos": 3, "str": "x"}]`,
+		`[{"op": "str_del", "path": "/s", "pos": 1, "len": 4}]`,
+		`{"s": "axf"}`},
+	{"overlapping text deletes", `{"s": "abcdef"}`,
+		`[{"op": "str_del", "path": "/s", "pos": 1, "len": 3}]`,
+		`[{"op": "str_del", "path": "/s", "pos": 2, "len": 3}]`,
+		`{"s": "af"}`},
+	{"text delete around insert", `{"s": "abcdef"}`,
+		`[{"op": "str_del", "path": "/s", "pos": 1, "len": 4}]`,
+		`[{"op": "str_ins", "path": "/s", "pos": 3, "str": "xy"}]`,
+		`{"s": "axyf"}`},
+	{"verified text deletes", `{"s": "abcdef"}`,
+		`[{"op": "str_del", "path": "/s", "pos": 1, "str": "bcd"}, {"op": "str_del", "path": "/s", "pos": 2, "str": "f"}]`,
+		`[{"op": "str_del", "path": "/s", "pos": 2, "str": "cde"}, {"op": "str_ins", "path": "/s", "pos": 0, "str": "xy"}]`,
+		`{"s": "xya"}`},
+	{"verified text delete around insert", `{"s": "abcdef"}`,
+		`[{"op": "str_del", "path": "/s", "pos": 1, "str": "bcde"}]`,
+		`[{"op": "str_ins", "path": "/s", "pos": 3, "str": "xy"}]`,
+		`{"s": "axyf"}`},
+	{"extend same keys", `{"a": {"x": 1}}`,
+		`[{"op": "extend", "path": "/a", "props": {"x": 2, "y": 2}}]`,
+		`[{"op": "extend", "path": "/a", "props": {"x": 3, "z": 3}}]`,
+		`{"a": {"x": 2, "y": 2, "z": 3}}`},
+	{"split shifts siblings", `["ab", "cd"]`,
+		`[{"op": "str_ins", "path": "/1", "pos": 0, "str": "x"}]`,
+		`[{"op": "split", "path": "/0", "pos": 1}]`,
+		`["a", "b", "xcd"]`},
+	{"predicates are shifted", `[1, 2]`,
+		`[{"op": "test", "path": "/1", "value": 2}, {"op": "and", "path": "/1", "apply": [{"op": "less", "path": "", "value": 5}]}]`,
+		`[{"op": "add", "path": "/0", "value": 0}]`,
+		`[0, 1, 2]`},
+}
+
+func Test_JsonPatchTransform_Transform_Converges(t *testing.T) {
+	for _, c := range transformCases {
+		a, _, err := CreateOps(parseJSON(c.a))
+		assert.Nil(t, err, c.name)
+		b, _, err := CreateOps(parseJSON(c.b))
+		assert.Nil(t, err, c.name)
+		a2, b2 := Transform(a, b)
+		doc1 := parseJSON(c.doc)
+		assert.Nil(t, ApplyOps(&doc1, a), c.name)
+		assert.Nil(t, ApplyOps(&doc1, b2), c.name)
+		doc2 := parseJSON(c.doc)
+		assert.Nil(t, ApplyOps(&doc2, b), c.name)
+		assert.Nil(t, ApplyOps(&doc2, a2), c.name)
+		assert.Equal(t, parseJSON(c.result), doc1, c.name)
+		assert.Equal(t, parseJSON(c.result), doc2, c.name)
+	}
+}
+
+// randomStructuralPatch returns up to three "add", "remove", "replace" and
+// "move" operations which apply to doc one after another. Returns false if a
+// generated operation does not apply, addresses the root or the end of an
+// array.
+func randomStructuralPatch(r *rand.Rand, doc JSON) ([]Op, bool) {
+	work := Copy(doc)
+	ops := []Op{}
+	for i := 1 + r.Intn(3); i > 0; i-- {
+		path := randomPointer(r, work)
+		var op Op
+		switch r.Intn(4) {
+		case 0:
+			op = &OpAdd{path: path, value: randomValue(r, 1)}
+		case 1:
+			op = &OpRemove{path: path}
+		case 2:
+			op = &OpReplace{path: path, value: randomValue(r, 1)}
+		case 3:
+			from := randomPointer(r, work)
+			if from.IsRoot() || from[len(from)-1] == "-" {
+				return nil, false
+			}
+			op = &OpMove{from: from, path: path}
+		}
+		if path.IsRoot() || path[len(path)-1] == "-" || op.Apply(&work) != nil {
+			return nil, false
+		}
+		ops = append(ops, op)
+	}
+	return ops, true
+}
+
+func Test_JsonPatchTransform_Transform_ConvergesOnRandomPatches(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for count := 0; count < 5000; {
+		doc := randomValue(r, 3)
+		a, ok := randomStructuralPatch(r, doc)
+		if !ok {
+			continue
+		}
+		b, ok := randomStructuralPatch(r, doc)
+		if !ok {
+			continue
+		}
+		count++
+		a2, b2 := Transform(a, b)
+		doc1 := Copy(doc)
+		assert.Nil(t, ApplyOps(&doc1, a))
+		err1 := ApplyOps(&doc1, b2)
+		doc2 := Copy(doc)
+		assert.Nil(t, ApplyOps(&doc2, b))
+		err2 := ApplyOps(&doc2, a2)
+		if !assert.Nil(t, err1) || !assert.Nil(t, err2) || !assert.Equal(t, doc1, doc2) {
+			t.Logf("doc: %v\na: %v\nb: %v", doc, PatchToJSON(a), PatchToJSON(b))
+			return
+		}
+	}
+}
+
+func Test_JsonPatchTransform_Transform_RewritesOperations(t *testing.T) {
+	a, _, _ := CreateOps(parseJSON(`[
+		{"op": "replace", "path": "/list/3/title", "value": "x"},
+		{"op": "test", "path": "/list/0", "value": 1}
+	]`))
+	b, _, _ := CreateOps(parseJSON(`[
+		{"op": "remove", "path": "/list/1"},
+		{"op": "add", "path": "/list/0", "value": 0}
+	]`))
+	a2, b2 := Transform(a, b)
+	assert.Equal(t, parseJSON(`[
+		{"op": "replace", "path": "/list/3/title", "value": "x"},
+		{"op": "test", "path": "/list/1", "value": 1}
+	]`), JSON(PatchToJSON(a2)))
+	assert.Equal(t, parseJSON(`[
+		{"op": "remove", "path": "/list/1"},
+		{"op": "add", "path": "/list/0", "value": 0}
+	]`), JSON(PatchToJSON(b2)))
+}
+
+func Test_JsonPatchTransform_Transform_EmptyPatches(t *testing.T) {
+	a, _, _ := CreateOps(parseJSON(`[{"op": "add", "path": "/a", "value": 1}]`))
+	a2, b2 := Transform(a, []Op{})
+	assert.Equal(t, a, a2)
+	assert.Equal(t, 0, len(b2))
+}
@@ -72,12 +72,13 @@ func NewJSONPointer(str string) (JSONPointer, error) {
 
 // ParseTokenAsArrayIndex parses JSON Pointer reference token to an integer,
 // which can be used as array index. Set maxIndex to -1 to ignore length check.
+// As in RFC 6901, the index consists of decimal digits without leading zeros.
 func ParseTokenAsArrayIndex(token string, maxIndex int) (int, error) {
-	index, err := strconv.Atoi(token)
-	if err != nil {
+	if !isIndexToken(token) {
 		return 0, ErrInvalidIndex
 	}
-	if index < 0 {
+	index, err := strconv.Atoi(token)
+	if err != nil {
 		return 0, ErrInvalidIndex
 	}
 	if maxIndex > -1 {
@@ -88,6 +89,19 @@ func ParseTokenAsArrayIndex(token string, maxIndex int) (int, error) {
 	return index, nil
 }
 
+// parseElementIndex parses JSON Pointer reference token as an index of an
+// existing element of an array of given length.
+func parseElementIndex(token string, length int) (int, error) {
+	index, err := ParseTokenAsArrayIndex(token, -1)
+	if err != nil {
+		return 0, err
+	}
+	if index >= length {
+		return 0, ErrInvalidIndex
+	}
+	return index, nil
+}
+
 // IsRoot returns true if JSON Pointer points to the root of a document.
 func (tokens JSONPointer) IsRoot() bool {
 	return len(tokens) == 0
@@ -121,7 +135,7 @@ func (tokens JSONPointer) Get(doc JSON) (JSON, error) {
 			}
 			return nil, ErrNotFound
 		case []JSON:
-			tokenIndex, err := ParseTokenAsArrayIndex(token, len(typedParent)-1)
+			tokenIndex, err := parseElementIndex(token, len(typedParent))
 			if err != nil {
 				return nil, err
 			}
@@ -150,7 +164,7 @@ func (tokens JSONPointer) Find(doc *JSON) (*JSON, error) {
 			}
 			return nil, ErrNotFound
 		case []JSON:
-			tokenIndex, err := ParseTokenAsArrayIndex(token, len(typedParent)-1)
+			tokenIndex, err := parseElementIndex(token, len(typedParent))
 			if err != nil {
 				return nil, err
 			}
@@ -182,7 +196,7 @@ func (tokens JSONPointer) Resolve(doc JSON) ([]JSON, error) {
 			}
 			return nil, ErrNotFound
 		case []JSON:
-			tokenIndex, err := ParseTokenAsArrayIndex(token, len(typedParent)-1)
+			tokenIndex, err := parseElementIndex(token, len(typedParent))
 			if err != nil {
 				return nil, err
 			}
@@ -214,7 +228,7 @@ func (tokens JSONPointer) Locate(doc JSON) (JSON, *string, error) {
 			}
 			return nil, nil, ErrNotFound
 		case []JSON:
-			tokenIndex, err := ParseTokenAsArrayIndex(token, len(typedParent)-1)
+			tokenIndex, err := parseElementIndex(token, len(typedParent))
 			if err != nil {
 				return nil, nil, err
 			}
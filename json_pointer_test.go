@@ -543,3 +543,30 @@ func Test_JSONPointer_Locate_CanLocateSecondLevelKeyInArray(t *testing.T) {
 	assert.Equal(t, "2", *key)
 	assert.Equal(t, "[1 2 3]", fmt.Sprint(obj))
 }
+
+func Test_JSONPointer_ReturnsErrorWhenIndexingPastEndOfArray(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"a": [], "b": [1]}`), &doc)
+	for _, tokens := range []JSONPointer{{"a", "0"}, {"b", "1"}, {"a", "0", "c"}} {
+		_, err := tokens.Get(doc)
+		assert.Equal(t, ErrInvalidIndex, err, tokens.Format())
+		_, err = tokens.Find(&doc)
+		assert.Equal(t, ErrInvalidIndex, err, tokens.Format())
+		_, err = tokens.Resolve(doc)
+		assert.Equal(t, ErrInvalidIndex, err, tokens.Format())
+		_, _, err = tokens.Locate(doc)
+		assert.Equal(t, ErrInvalidIndex, err, tokens.Format())
+	}
+}
+
+func Test_ParseTokenAsArrayIndex_RejectsNonCanonicalIndices(t *testing.T) {
+	for _, token := range []string{"", "01", "00", "+1", "-1", " 1", "1e0", "0x1"} {
+		_, err := ParseTokenAsArrayIndex(token, -1)
+		assert.Equal(t, ErrInvalidIndex, err, token)
+	}
+	for token, expected := range map[string]int{"0": 0, "1": 1, "10": 10} {
+		index, err := ParseTokenAsArrayIndex(token, -1)
+		assert.Nil(t, err, token)
+		assert.Equal(t, expected, index, token)
+	}
+}
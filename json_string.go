@@ -0,0 +1,63 @@
+package jsonjoy
+
+import (
+	"unicode/utf8"
+)
+
+// PositionUnit is a unit in which positions and lengths of strings are
+// measured by "str_ins", "str_del", "split", "test_string" and
+// "test_string_len" operations. The unit of an operation is set when it is
+// created, see CreateOptions. UTF-16 code units are used by default for
+// compatibility with json-joy.
+type PositionUnit int
+
+const (
+	// PositionUTF16 counts UTF-16 code units, as JavaScript does. Characters
+	// outside of the Basic Multilingual Plane take two units.
+	PositionUTF16 PositionUnit = iota
+	// PositionRunes counts Unicode code points.
+	PositionRunes
+)
+
+// runeUnits returns number of units taken by a character.
+func runeUnits(r rune, unit PositionUnit) int {
+	if unit == PositionUTF16 && r > 0xffff {
+		return 2
+	}
+	return 1
+}
+
+// stringLength returns length of str in units of unit.
+func stringLength(str string, unit PositionUnit) int {
+	if unit == PositionRunes {
+		return utf8.RuneCountInString(str)
+	}
+	length := 0
+	for _, r := range str {
+		length += runeUnits(r, unit)
+	}
+	return length
+}
+
+// stringOffset returns byte offset in str of position pos. Positions past
+// the end are clamped to length of str, a position in the middle of a
+// character, possible for UTF-16 surrogate pairs, points after it.
+func stringOffset(str string, pos int, unit PositionUnit) int {
+	for offset, r := range str {
+		if pos <= 0 {
+			return offset
+		}
+		pos -= runeUnits(r, unit)
+	}
+	return len(str)
+}
+
+// substring returns part of str between positions start and end.
+func substring(str string, start int, end int, unit PositionUnit) string {
+	from := stringOffset(str, start, unit)
+	to := stringOffset(str, end, unit)
+	if to < from {
+		return ""
+	}
+	return str[from:to]
+}
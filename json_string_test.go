@@ -0,0 +1,135 @@
+package jsonjoy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_JsonString_StringLength(t *testing.T) {
+	assert.Equal(t, 5, stringLength("héllo", PositionUTF16))
+	assert.Equal(t, 4, stringLength("a😀b", PositionUTF16))
+	assert.Equal(t, 3, stringLength("a😀b", PositionRunes))
+}
+
+func Test_JsonString_StringOffset(t *testing.T) {
+	assert.Equal(t, 0, stringOffset("a😀b", -1, PositionUTF16))
+	assert.Equal(t, 1, stringOffset("a😀b", 1, PositionUTF16))
+	assert.Equal(t, 5, stringOffset("a😀b", 2, PositionUTF16), "middle of surrogate pair")
+	assert.Equal(t, 5, stringOffset("a😀b", 3, PositionUTF16))
+	assert.Equal(t, 6, stringOffset("a😀b", 10, PositionUTF16))
+	assert.Equal(t, 5, stringOffset("a😀b", 2, PositionRunes))
+}
+
+func Test_JsonString_StrIns_CountsUTF16CodeUnits(t *testing.T) {
+	doc := parseJSON(`{"s": "héllo", "e": "😀😀"}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "str_ins", "path": "/s", "pos": 3, "str": "X"},
+		{"op": "str_ins", "path": "/e", "pos": 2, "str": "Y"}
+	]`))
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, parseJSON(`{"s": "hélXlo", "e": "😀Y😀"}`), doc)
+}
+
+func Test_JsonString_StrDel_CountsUTF16CodeUnits(t *testing.T) {
+	doc := parseJSON(`{"s": "héllo😀!"}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "str_del", "path": "/s", "pos": 1, "len": 1},
+		{"op": "str_del", "path": "/s", "pos": 4, "str": "😀"}
+	]`))
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, parseJSON(`{"s": "hllo!"}`), doc)
+}
+
+func Test_JsonString_StrIns_Runes(t *testing.T) {
+	doc := parseJSON(`"😀😀"`)
+	ops, _, err := CreateOpsWithOptions(parseJSON(`[
+		{"op": "str_ins", "path": "", "pos": 1, "str": "Y"},
+		{"op": "str_del", "path": "", "pos": 2, "len": 1}
+	]`), CreateOptions{PositionUnit: PositionRunes})
+	assert.Nil(t, err)
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, "😀Y", doc)
+}
+
+func Test_JsonString_CreateOpsWithOptions_UnitIsKeptByOperations(t *testing.T) {
+	patch := parseJSON(`[
+		{"op": "and", "path": "/s", "apply": [
+			{"op": "test_string", "path": "", "pos": 1, "str": "é"},
+			{"op": "test_string_len", "path": "", "len": 2}
+		]},
+		{"op": "str_del", "path": "/s", "pos": 0, "str": "😀"}
+	]`)
+	runes, _, err := CreateOpsWithOptions(patch, CreateOptions{PositionUnit: PositionRunes})
+	assert.Nil(t, err)
+	utf16, _, err := CreateOps(patch)
+	assert.Nil(t, err)
+	doc := parseJSON(`{"s": "😀é"}`)
+	assert.NotNil(t, ApplyOps(&doc, utf16))
+	assert.Nil(t, ApplyOps(&doc, runes))
+	assert.Equal(t, parseJSON(`{"s": "é"}`), doc)
+	assert.Equal(t, 1, runes[1].(*OpStrDel).Len())
+	assert.Equal(t, 2, utf16[1].(*OpStrDel).Len())
+}
+
+func Test_JsonString_PatchBuilder_PositionUnit(t *testing.T) {
+	ops, err := NewPatchBuilder().
+		StrIns("", 1, "Y").
+		PositionUnit(PositionRunes).
+		StrIns("", 1, "Z").
+		Build()
+	assert.Nil(t, err)
+	var doc JSON = "😀😀"
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, "😀ZY😀", doc)
+}
+
+func Test_JsonString_Predicates_CountUTF16CodeUnits(t *testing.T) {
+	assert.Nil(t, applyPredicatePatch(t, `{"s": "😀é"}`, `[
+		{"op": "test_string", "path": "/s", "pos": 2, "str": "é"},
+		{"op": "test_string_len", "path": "/s", "len": 3},
+		{"op": "test_string_len", "path": "/s", "len": 4, "not": true}
+	]`))
+}
+
+func Test_JsonString_Split_CountsUTF16CodeUnits(t *testing.T) {
+	doc, err := applySlatePatch(t, `[{"text": "😀é"}]`, `[
+		{"op": "split", "path": "/0", "pos": 2}
+	]`)
+	assert.Nil(t, err)
+	assert.Equal(t, parseJSON(`[{"text": "😀"}, {"text": "é"}]`), doc)
+}
+
+func Test_JsonString_DiffText_CountsUTF16CodeUnits(t *testing.T) {
+	ops := DiffText(JSONPointer{}, "😀 cat", "😀 dog")
+	assert.Equal(t, parseJSON(`[
+		{"op": "str_del", "path": "", "pos": 3, "len": 3},
+		{"op": "str_ins", "path": "", "pos": 3, "str": "dog"}
+	]`), JSON(PatchToJSON(ops)))
+}
+
+func Test_JsonString_DiffWithOptions_Runes(t *testing.T) {
+	opts := DiffOptions{PositionUnit: PositionRunes}
+	ops := DiffWithOptions("😀 cat", "😀 dog", opts)
+	assert.Equal(t, parseJSON(`[
+		{"op": "str_del", "path": "", "pos": 2, "len": 3},
+		{"op": "str_ins", "path": "", "pos": 2, "str": "dog"}
+	]`), JSON(PatchToJSON(ops)))
+	var doc JSON = "😀 cat"
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, "😀 dog", doc)
+}
+
+func Test_JsonString_Invert_CountsUTF16CodeUnits(t *testing.T) {
+	doc := parseJSON(`{"s": "😀é😀"}`)
+	ops, _, _ := CreateOps(parseJSON(`[
+		{"op": "str_del", "path": "/s", "pos": 2, "len": 3},
+		{"op": "str_ins", "path": "/s", "pos": 2, "str": "😀"}
+	]`))
+	undo, err := Invert(doc, ops)
+	assert.Nil(t, err)
+	assert.Nil(t, ApplyOps(&doc, ops))
+	assert.Equal(t, parseJSON(`{"s": "😀😀"}`), doc)
+	assert.Nil(t, ApplyOps(&doc, undo))
+	assert.Equal(t, parseJSON(`{"s": "😀é😀"}`), doc)
+}